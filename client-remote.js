@@ -4,6 +4,10 @@ process.env.LANG = 'en_US.UTF-8';
 const blessed = require('blessed');
 const readline = require('readline');
 const axios = require('axios');
+const WebSocket = require('ws');
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
 
 // 从命令行参数或环境变量获取远程服务器地址
 const REMOTE_URL = process.argv[2] || process.env.CICY_REMOTE_URL || 'http://localhost:13001';
@@ -49,12 +53,110 @@ async function checkConnection() {
     return false;
 }
 
+// 通过 /ws 接收其他客户端发送的新消息，连接可用时也经由它发送
+let liveSocket = null;
+let liveStatus = '';
+let lastMessageId = 0;
+let liveSeq = 0;
+const livePending = new Map();
+const liveMessages = [];
+
+function connectLive() {
+    const url = REMOTE_URL.replace(/^http/, 'ws') + '/ws' + (lastMessageId ? `?after_id=${lastMessageId}` : '');
+    const token = loadToken();
+    const ws = new WebSocket(url, { headers: token ? { Authorization: `Bearer ${token}` } : {} });
+
+    ws.on('open', () => {
+        liveSocket = ws;
+        liveStatus = 'live';
+        render();
+    });
+
+    ws.on('message', (data) => {
+        let event;
+        try {
+            event = JSON.parse(data);
+        } catch (error) {
+            return;
+        }
+        (event.ids || []).concat(event.message ? [event.message.id] : []).forEach((id) => {
+            lastMessageId = Math.max(lastMessageId, id);
+        });
+
+        if (event.type === 'message') {
+            liveMessages.push(formatLiveMessage(event.message));
+            if (liveMessages.length > 5) {
+                liveMessages.shift();
+            }
+            render();
+            return;
+        }
+        const pending = livePending.get(event.ref);
+        if (pending && (event.type === 'reply' || event.type === 'error')) {
+            livePending.delete(event.ref);
+            event.type === 'reply' ? pending.resolve(event.text) : pending.reject(new Error(event.error));
+        }
+    });
+
+    ws.on('error', (error) => {
+        // token 无效时不再重连
+        if (/: 40[13]$/.test(error.message)) {
+            liveStatus = 'unauthorized';
+        }
+    });
+
+    ws.on('close', () => {
+        liveSocket = null;
+        livePending.forEach((pending) => pending.reject(new Error('connection lost')));
+        livePending.clear();
+        if (liveStatus !== 'unauthorized') {
+            liveStatus = '';
+            setTimeout(connectLive, 2000);
+        }
+        render();
+    });
+}
+
+function formatLiveMessage(msg) {
+    const from = msg.sender ? `${msg.sender}: ` : '';
+    if (msg.type === 'image') {
+        return `${from}[image] ${msg.name} (/image ${msg.id})`;
+    }
+    if (msg.type === 'attachment') {
+        return `${from}[file] ${msg.name} #${msg.id}`;
+    }
+    return from + msg.text;
+}
+
+function sendLive(text) {
+    const ref = `r${++liveSeq}`;
+    return new Promise((resolve, reject) => {
+        livePending.set(ref, { resolve, reject });
+        liveSocket.send(JSON.stringify({ type: 'send', ref, text, reply: true }));
+    });
+}
+
 async function sendToServer(text) {
     isLoading = true;
     render();
 
+    // 经由 /ws 发送时自己的消息不会被推送回来
+    if (liveSocket) {
+        try {
+            lastA = await sendLive(text);
+        } catch (error) {
+            lastA = 'Error: ' + error.message;
+        }
+        isLoading = false;
+        render();
+        return;
+    }
+
     try {
-        const response = await axios.post(`${REMOTE_URL}/message`, { message: text }, { timeout: 10000 });
+        const response = await axios.post(`${REMOTE_URL}/message`, { message: text }, {
+            headers: { Authorization: `Bearer ${loadToken()}` },
+            timeout: 10000
+        });
         lastA = response.data.message || 'Message received!';
         connectionStatus = 'connected';
     } catch (error) {
@@ -74,6 +176,52 @@ async function sendToServer(text) {
     render();
 }
 
+// 读取 API token：CICY_TOKEN 环境变量或 ~/data/cicy-server.txt
+function loadToken() {
+    if (process.env.CICY_TOKEN) {
+        return process.env.CICY_TOKEN;
+    }
+    try {
+        return fs.readFileSync(path.join(os.homedir(), 'data', 'cicy-server.txt'), 'utf8').trim();
+    } catch (error) {
+        return '';
+    }
+}
+
+const IMAGE_EXTENSIONS = {
+    'image/png': '.png',
+    'image/jpeg': '.jpg',
+    'image/gif': '.gif',
+    'image/webp': '.webp'
+};
+
+// 下载服务器上的图片到临时目录
+async function fetchImage(id) {
+    isLoading = true;
+    render();
+
+    try {
+        const response = await axios.get(`${REMOTE_URL}/api/images/${id}/raw`, {
+            headers: { Authorization: `Bearer ${loadToken()}` },
+            responseType: 'arraybuffer',
+            timeout: 30000
+        });
+        const ext = IMAGE_EXTENSIONS[response.headers['content-type']] || '';
+        const file = path.join(os.tmpdir(), `cicy-image-${id}${ext}`);
+        fs.writeFileSync(file, Buffer.from(response.data));
+        lastA = `Saved image ${id} to ${file}`;
+    } catch (error) {
+        if (error.response) {
+            lastA = `Error: image ${id}: HTTP ${error.response.status}`;
+        } else {
+            lastA = 'Error: ' + error.message;
+        }
+    }
+
+    isLoading = false;
+    render();
+}
+
 function getStatusColor() {
     switch (connectionStatus) {
         case 'connected': return '#9ece6a';
@@ -103,7 +251,11 @@ function render() {
     // 标题和状态
     content += '{bold}{fg #7aa2f7}◇ CICY Remote{/fg}{/bold}\n';
     content += `{fg ${getStatusColor()}}${getStatusText()}{/fg} `;
-    content += `{fg #565f89}${REMOTE_URL}{/fg}\n\n`;
+    content += `{fg #565f89}${REMOTE_URL}{/fg}`;
+    if (liveStatus) {
+        content += ` {fg ${liveStatus === 'live' ? '#9ece6a' : '#f7768e'}}(${liveStatus}){/fg}`;
+    }
+    content += '\n\n';
 
     if (qLines.length > 0) {
         qLines.forEach((line) => {
@@ -123,6 +275,13 @@ function render() {
         content += '{fg #565f89}No messages yet{/fg}\n\n';
     }
 
+    if (liveMessages.length > 0) {
+        liveMessages.forEach((line) => {
+            content += `{fg #7dcfff}📨 ${line}{/fg}\n`;
+        });
+        content += '\n';
+    }
+
     content += '{fg #414868}────────────────────────────────────{/fg}\n\n';
 
     if (isLoading) {
@@ -158,9 +317,18 @@ rl.on('line', async (input) => {
         return;
     }
     
+    if (trimmed.startsWith('/image ')) {
+        lastQ = trimmed;
+        lastA = '';
+        await fetchImage(trimmed.slice('/image '.length).trim());
+        process.stdout.write('> ');
+        return;
+    }
+    
     if (trimmed === '/help') {
         console.log('\nCommands:');
         console.log('  /status - Check connection status');
+        console.log('  /image ID - Download an image from the server');
         console.log('  /quit   - Exit');
         console.log('  /help   - Show this help');
         process.stdout.write('> ');
@@ -196,9 +364,10 @@ process.stdin.on('keypress', (ch, key) => {
         console.log('You can still send messages, but they may fail.');
     }
     
-    console.log('\nCommands: /status, /help, /quit');
+    console.log('\nCommands: /status, /image ID, /help, /quit');
     console.log('');
     
+    connectLive();
     render();
     process.stdout.write('> ');
 })();
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 附件大小上限（--max-attachment-size）
+var maxAttachmentSize int64 = 50 * 1024 * 1024
+
+// 附件消息结构（发送到 TUI）
+type attachmentMsg struct {
+	path   string
+	name   string
+	size   string
+	sender string
+}
+
+// 处理 attachment / resource 内容项
+//
+//	{"type": "attachment", "name": "build.log", "mimeType": "text/plain", "url": "..." | "data": "<base64>"}
+//	{"type": "resource", "resource": {"uri": "file:///tmp/build.log", "mimeType": "text/plain", "text": "..." | "blob": "<base64>"}}
+func ingestAttachment(ctx context.Context, item map[string]interface{}) (Message, error) {
+	itemType, _ := item["type"].(string)
+
+	var name, mimeType, fileURL, data, text string
+	if itemType == "resource" {
+		// MCP 嵌入资源格式
+		resource, _ := item["resource"].(map[string]interface{})
+		if resource == nil {
+			return Message{}, newAPIError(http.StatusBadRequest, "resource is required")
+		}
+		uri, _ := resource["uri"].(string)
+		name, _ = resource["name"].(string)
+		if name == "" {
+			name = nameFromURI(uri)
+		}
+		mimeType, _ = resource["mimeType"].(string)
+		data, _ = resource["blob"].(string)
+		text, _ = resource["text"].(string)
+		if data == "" && text == "" {
+			return Message{}, newAPIError(http.StatusBadRequest, "resource text or blob is required")
+		}
+	} else {
+		name, _ = item["name"].(string)
+		if name == "" {
+			name, _ = item["filename"].(string)
+		}
+		mimeType, _ = item["mimeType"].(string)
+		fileURL, _ = item["url"].(string)
+		data, _ = item["data"].(string)
+		if name == "" && fileURL != "" {
+			name = nameFromURI(fileURL)
+		}
+	}
+
+	var raw []byte
+	var err error
+	switch {
+	case text != "":
+		if int64(len(text)) > maxAttachmentSize {
+			return Message{}, newAPIError(http.StatusRequestEntityTooLarge, "file too large (max %s)", formatSize(int(maxAttachmentSize)))
+		}
+		raw = []byte(text)
+	case fileURL != "":
+		raw, err = downloadFile(ctx, fileURL, maxAttachmentSize, "file")
+	case data != "":
+		raw, err = decodeBase64Data(data, maxAttachmentSize, "file")
+	default:
+		err = newAPIError(http.StatusBadRequest, "url or data is required")
+	}
+	if err != nil {
+		return Message{}, err
+	}
+
+	return addAttachmentMessage(ctx, raw, name, mimeType)
+}
+
+// 从 URI 中取文件名
+func nameFromURI(uri string) string {
+	if u, err := url.Parse(uri); err == nil && u.Path != "" {
+		return path.Base(u.Path)
+	}
+	return ""
+}
+
+// 文件名只保留最后一段，去掉路径和控制字符
+func sanitizeFileName(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = path.Base(name)
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "." || name == "/" || name == ".." {
+		return ""
+	}
+	return name
+}
+
+// 附件保存时使用的扩展名（便于用系统程序打开），只接受简单的扩展名
+func attachmentExt(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if len(ext) < 2 || len(ext) > 10 {
+		return ""
+	}
+	for _, r := range ext[1:] {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9') {
+			return ""
+		}
+	}
+	return ext
+}
+
+// 确定附件的 MIME 类型：客户端指定 > 扩展名 > 内容识别
+func attachmentMimeType(data []byte, name, mimeType string) string {
+	if mimeType != "" {
+		return mimeType
+	}
+	if ext := filepath.Ext(name); ext != "" {
+		if t := mime.TypeByExtension(ext); t != "" {
+			return t
+		}
+	}
+	return http.DetectContentType(data)
+}
+
+// 保存收到的附件（按内容寻址），并通知 TUI 和 MCP 客户端
+func addAttachmentMessage(ctx context.Context, data []byte, name, mimeType string) (Message, error) {
+	mimeType = attachmentMimeType(data, name, mimeType)
+	name = sanitizeFileName(name)
+	if name == "" {
+		// 没有文件名时按 MIME 类型补扩展名
+		name = "attachment"
+		if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+			name += exts[0]
+		}
+	}
+
+	sum, filePath, err := putBlob(data, attachmentExt(name))
+	if err != nil {
+		return Message{}, fmt.Errorf("保存附件失败: %v", err)
+	}
+
+	msg, err := appendMessage(ctx, Message{
+		Type:      "attachment",
+		Name:      name,
+		MimeType:  mimeType,
+		SHA256:    sum,
+		Size:      len(data),
+		Timestamp: time.Now(),
+	})
+	unpinBlob(filePath)
+	if err != nil {
+		removeUnusedBlobs([]Message{msg})
+		return msg, err
+	}
+
+	sizeStr := formatSize(len(data))
+	log.Printf("📎 收到附件 %s (%s, 大小: %s)", name, mimeType, sizeStr)
+	broadcastLog("info", imageNotice(msg, len(data)))
+
+	if tuiProgram != nil {
+		tuiProgram.Send(attachmentMsg{path: filePath, name: name, size: sizeStr, sender: msg.Sender})
+	}
+	return msg, nil
+}
+
+// GET /api/attachments/{id}      附件元数据（JSON）
+// GET /api/attachments/{id}/raw  附件内容（Content-Disposition 带原文件名）
+func attachmentAPIHandler(w http.ResponseWriter, r *http.Request) {
+	serveBlobAPI(w, r, "/api/attachments/", "attachment", "Attachment")
+}
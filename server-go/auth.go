@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 不需要 token 的路径（--public-paths，逗号分隔），其他端点默认都需要认证
+var publicPaths = map[string]bool{"/health": true}
+
+// 监听地址（--bind），空表示所有网卡；127.0.0.1 只允许本机访问
+var bindAddress string
+
+func parsePublicPaths(value string) map[string]bool {
+	paths := map[string]bool{}
+	for _, path := range strings.Split(value, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths[path] = true
+		}
+	}
+	return paths
+}
+
+func publicPathList() string {
+	var paths []string
+	for path := range publicPaths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return strings.Join(paths, ", ")
+}
+
+// 请求携带的 token：Authorization: Bearer <token> 或 X-Auth-Token；
+// 浏览器的 WebSocket 不能设置请求头，/ws 也接受子协议中的 token 和 ?token=（会出现在访问日志中，见 ws.go）
+func requestToken(r *http.Request) string {
+	if token := r.Header.Get("Authorization"); token != "" {
+		return strings.TrimPrefix(token, "Bearer ")
+	}
+	if token := r.Header.Get("X-Auth-Token"); token != "" {
+		return token
+	}
+	if r.URL.Path == "/ws" {
+		if token := wsProtocolToken(r); token != "" {
+			return token
+		}
+		return r.URL.Query().Get("token")
+	}
+	return ""
+}
+
+// 客户端请求带上 token；没有 token 时不带，服务器可以用客户端证书认证
+func setAuthHeader(req *http.Request, token string) {
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// 所有请求统一认证（token 或客户端证书），白名单中的路径除外；认证后的客户端放进 context，按路由检查权限
+func authHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := lookupClient(requestToken(r))
+		if client == nil {
+			client = certClient(r)
+		}
+		if client == nil && !publicPaths[r.URL.Path] {
+			// 认证失败也消耗来源 IP 的令牌，限制暴力猜测 token
+			if ok, wait := takeToken(limitKey(r), time.Now()); !ok {
+				writeRateLimited(w, r, wait)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="cicy"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		ctx := withClient(r.Context(), client)
+		if err := requireScope(ctx, routeScope(r)); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
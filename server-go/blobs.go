@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// 附件按内容寻址保存在数据目录（--data-dir）下：
+//
+//	<data-dir>/blobs/<sha256 前两位>/<sha256><扩展名>
+//
+// 相同内容只保存一份；删除消息后没有其他消息引用的文件随之删除
+var dataDir = defaultDataDir()
+
+// 已保存但消息还没有写入存储的文件，清理时跳过
+var pinnedBlobs = struct {
+	sync.Mutex
+	counts map[string]int
+}{counts: map[string]int{}}
+
+func defaultDataDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "cicy-data"
+	}
+	return filepath.Join(homeDir, "data", "cicy")
+}
+
+// 根据 MIME 类型取文件扩展名
+func extForMimeType(mimeType string) string {
+	switch mimeType {
+	case "image/png":
+		return ".png"
+	case "image/jpeg":
+		return ".jpg"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	}
+	return ""
+}
+
+func blobPath(sum, ext string) string {
+	return filepath.Join(dataDir, "blobs", sum[:2], sum+ext)
+}
+
+// 保存内容，返回 SHA-256 和文件路径；已存在时直接复用
+// 成功时文件被固定，写入消息后调用 unpinBlob，在此之前不会被清理
+func putBlob(data []byte, ext string) (string, string, error) {
+	hash := sha256.Sum256(data)
+	sum := hex.EncodeToString(hash[:])
+	path := blobPath(sum, ext)
+
+	pinnedBlobs.Lock()
+	pinnedBlobs.counts[path]++
+	pinnedBlobs.Unlock()
+	if err := writeBlob(path, data); err != nil {
+		unpinBlob(path)
+		return "", "", err
+	}
+	return sum, path, nil
+}
+
+func unpinBlob(path string) {
+	pinnedBlobs.Lock()
+	defer pinnedBlobs.Unlock()
+	if pinnedBlobs.counts[path]--; pinnedBlobs.counts[path] <= 0 {
+		delete(pinnedBlobs.counts, path)
+	}
+}
+
+func writeBlob(path string, data []byte) error {
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// 先写临时文件再重命名，避免并发写入时读到半个文件
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// 消息附件在磁盘上的路径
+func messageBlobPath(msg Message) string {
+	if msg.SHA256 == "" {
+		return ""
+	}
+	if msg.Type == "attachment" {
+		return blobPath(msg.SHA256, attachmentExt(msg.Name))
+	}
+	return blobPath(msg.SHA256, extForMimeType(msg.MimeType))
+}
+
+// 读取消息附件内容；旧版本的记录把 base64 直接存在 Data 中
+func readBlob(msg Message) ([]byte, error) {
+	if path := messageBlobPath(msg); path != "" {
+		return os.ReadFile(path)
+	}
+	if msg.Data != "" {
+		return base64.StdEncoding.DecodeString(msg.Data)
+	}
+	return nil, fmt.Errorf("message %d has no attachment", msg.ID)
+}
+
+// 删除消息后清理它们的文件；相同内容的文件可能还被其他消息引用，只删除已没有引用的
+func removeUnusedBlobs(deleted []Message) {
+	candidates := map[string]bool{}
+	for _, msg := range deleted {
+		if path := messageBlobPath(msg); path != "" {
+			candidates[path] = true
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+
+	// 持有锁时新的文件不能被固定，存储中的引用和固定的文件合起来是完整的
+	pinnedBlobs.Lock()
+	defer pinnedBlobs.Unlock()
+	messages, err := store.List()
+	if err != nil {
+		log.Printf("❌ 清理附件文件失败: %v", err)
+		return
+	}
+	for _, msg := range messages {
+		delete(candidates, messageBlobPath(msg))
+	}
+	for path := range candidates {
+		if pinnedBlobs.counts[path] > 0 {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("⚠️  删除附件文件失败: %v", err)
+		}
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// 子命令：cicy-go send / tail / token / tui
+//
+// 客户端命令通过 HTTP 访问服务器，地址和 token 来自配置（url / token / token-file，见 config.go）
+
+// token 文件路径
+func tokenFilePath() string {
+	return appConfig.get("token-file")
+}
+
+func readTokenFile() string {
+	data, err := os.ReadFile(tokenFilePath())
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func writeTokenFile(token string) error {
+	path := tokenFilePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(token), 0600)
+}
+
+// 客户端使用的 token：参数 > 配置中的 token（CICY_TOKEN）> token 文件
+func resolveToken(token string) string {
+	if token != "" {
+		return token
+	}
+	if token := appConfig.get("token"); token != "" {
+		return token
+	}
+	return readTokenFile()
+}
+
+// 客户端命令共用的参数，默认值来自配置；返回 --token，服务器地址在解析参数后用 appConfig.get("url") 读取
+func clientFlags(fs *flag.FlagSet) *string {
+	fs.String("config", appConfig.path, "配置文件 (YAML)")
+	fs.String("token-file", appConfig.get("token-file"), "API token 文件")
+	fs.String("url", appConfig.get("url"), "服务器地址 (CICY_URL，默认 localhost 上的 --port)")
+	port := fs.Int("port", appConfig.intValue("port"), "未指定 --url 时连接的本机端口")
+	fs.IntVar(port, "p", appConfig.intValue("port"), "未指定 --url 时连接的本机端口")
+	token := fs.String("token", "", "API token (CICY_TOKEN，默认读取 token 文件)")
+	fs.String("tls-ca", appConfig.get("tls-ca"), "只信任该 CA 签发的服务器证书 (PEM)")
+	fs.String("tls-client-cert", appConfig.get("tls-client-cert"), "双向 TLS 的客户端证书 (PEM)")
+	fs.String("tls-client-key", appConfig.get("tls-client-key"), "客户端证书的私钥 (PEM)")
+	return token
+}
+
+// 解析客户端命令的参数，按配置设置 TLS
+func parseClientFlags(fs *flag.FlagSet, args []string) {
+	fs.Parse(args)
+	appConfig.applyFlags(fs)
+	appConfig.deriveURL()
+	if err := setupClientTLS(); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		os.Exit(2)
+	}
+}
+
+// 可重复的字符串参数（--image a.png --image b.png）
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
+// cicy-go send "text" / send --image file.png / send --file build.log / echo text | send -
+func runSend(args []string) int {
+	fs := flag.NewFlagSet("send", flag.ExitOnError)
+	token := clientFlags(fs)
+	var images, files stringList
+	fs.Var(&images, "image", "发送图片文件 (可重复)")
+	fs.Var(&files, "file", "发送附件 (可重复)")
+	mimeType := fs.String("mime", "", "附件的 MIME 类型 (默认按扩展名识别)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "用法: cicy-go send [选项] [文本 | -]\n\n")
+		fs.PrintDefaults()
+	}
+	parseClientFlags(fs, args)
+
+	var content []map[string]interface{}
+	if fs.NArg() > 0 {
+		text := strings.Join(fs.Args(), " ")
+		if text == "-" {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "❌ 读取 stdin 失败: %v\n", err)
+				return 1
+			}
+			text = strings.TrimRight(string(data), "\n")
+		}
+		if text != "" {
+			content = append(content, map[string]interface{}{"type": "text", "text": text})
+		}
+	}
+	for _, path := range images {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 1
+		}
+		content = append(content, map[string]interface{}{
+			"type": "image",
+			"data": base64.StdEncoding.EncodeToString(data),
+		})
+	}
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 1
+		}
+		content = append(content, map[string]interface{}{
+			"type":     "attachment",
+			"name":     filepath.Base(path),
+			"mimeType": *mimeType,
+			"data":     base64.StdEncoding.EncodeToString(data),
+		})
+	}
+	if len(content) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"content": content})
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(appConfig.get("url"), "/")+"/api/message", bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setAuthHeader(req, resolveToken(*token))
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 无法连接到服务器: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Error   string `json:"error"`
+		Results []struct {
+			Success bool   `json:"success"`
+			ID      int    `json:"id"`
+			Error   string `json:"error"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ HTTP %s\n", resp.Status)
+		return 1
+	}
+	if result.Error != "" {
+		fmt.Fprintf(os.Stderr, "❌ %s\n", result.Error)
+		return 1
+	}
+
+	// 每个内容项输出一行消息 ID，便于脚本使用
+	code := 0
+	for _, r := range result.Results {
+		if r.Success {
+			fmt.Println(r.ID)
+		} else {
+			fmt.Fprintf(os.Stderr, "❌ %s\n", r.Error)
+			code = 1
+		}
+	}
+	return code
+}
+
+// cicy-go tail：持续输出新消息
+func runTail(args []string) int {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	token := clientFlags(fs)
+	jsonOutput := fs.Bool("json", false, "每条消息输出一行 JSON")
+	parseClientFlags(fs, args)
+
+	serverURL := strings.TrimRight(appConfig.get("url"), "/")
+	if !isCicyServer(serverURL) {
+		fmt.Fprintf(os.Stderr, "❌ 无法连接到服务器: %s\n", serverURL)
+		return 1
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	err := followMessages(serverURL, resolveToken(*token), func(msg Message) {
+		if *jsonOutput {
+			encoder.Encode(msg)
+			return
+		}
+		ts := msg.Timestamp.Local().Format("15:04:05")
+		if msg.Sender != "" {
+			ts += " " + msg.Sender
+		}
+		switch msg.Type {
+		case "text":
+			fmt.Printf("[%s] %s\n", ts, msg.Text)
+		case "image":
+			fmt.Printf("[%s] 🖼️  %s (%s) #%d\n", ts, msg.Name, formatSize(msg.Size), msg.ID)
+		case "attachment":
+			fmt.Printf("[%s] 📎 %s (%s) #%d\n", ts, msg.Name, formatSize(msg.Size), msg.ID)
+		}
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// cicy-go token show|rotate|add|list|revoke
+func runToken(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "用法: cicy-go token show|rotate|add|list|revoke\n")
+		return 2
+	}
+
+	switch args[0] {
+	case "show":
+		token := readTokenFile()
+		if token == "" {
+			fmt.Fprintf(os.Stderr, "❌ 还没有 token，启动服务器或运行 cicy-go token rotate 生成\n")
+			return 1
+		}
+		fmt.Println(token)
+		return 0
+
+	case "rotate":
+		token := generateToken()
+		if err := writeTokenFile(token); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ 无法保存 token: %v\n", err)
+			return 1
+		}
+		fmt.Println(token)
+		fmt.Fprintf(os.Stderr, "✓ 已生成新 token: %s (运行中的服务器需要重启后生效)\n", tokenFilePath())
+		return 0
+
+	case "add":
+		return runTokenAdd(args[1:])
+
+	case "list":
+		f, err := readTokensFile()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 1
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "NAME\tSCOPES\tCERT CN\tCREATED\n")
+		fmt.Fprintf(tw, "%s\t%s\t-\t%s\n", defaultClientName, scopeAdmin, tokenFilePath())
+		list := append([]*apiClient(nil), f.Tokens...)
+		sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+		for _, c := range list {
+			cn := c.CertCN
+			if cn == "" {
+				cn = "-"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", c.Name, strings.Join(c.Scopes, ","), cn, c.Created.Local().Format("2006-01-02 15:04"))
+		}
+		tw.Flush()
+		return 0
+
+	case "revoke":
+		if len(args) != 2 {
+			fmt.Fprintf(os.Stderr, "用法: cicy-go token revoke NAME\n")
+			return 2
+		}
+		if args[1] == defaultClientName {
+			fmt.Fprintf(os.Stderr, "❌ default token 不能撤销，使用 cicy-go token rotate 更换\n")
+			return 1
+		}
+		f, err := readTokensFile()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 1
+		}
+		if !f.revoke(args[1]) {
+			fmt.Fprintf(os.Stderr, "❌ 没有名为 %s 的客户端\n", args[1])
+			return 1
+		}
+		if err := writeTokensFile(f); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ 无法保存 %s: %v\n", tokensFilePath(), err)
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "✓ 已撤销 %s (立即生效)\n", args[1])
+		return 0
+
+	default:
+		fmt.Fprintf(os.Stderr, "未知的 token 命令: %s (可选: show, rotate, add, list, revoke)\n", args[0])
+		return 2
+	}
+}
+
+// cicy-go token add NAME [--scopes messages:read,messages:write] [--cert-cn CN]
+func runTokenAdd(args []string) int {
+	fs := flag.NewFlagSet("token add", flag.ExitOnError)
+	scopesFlag := fs.String("scopes", defaultScopes, "权限，逗号分隔: "+strings.Join(allScopes, ", "))
+	certCN := fs.String("cert-cn", "", "允许 CN 为该值的客户端证书（双向 TLS）代替 token")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "用法: cicy-go token add NAME [--scopes S] [--cert-cn CN]\n\n")
+		fs.PrintDefaults()
+	}
+	// 名字可以写在参数前面
+	var name string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	fs.Parse(args)
+	if name == "" && fs.NArg() == 1 {
+		name = fs.Arg(0)
+	} else if name == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	scopes, err := parseScopes(*scopesFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+	f, err := readTokensFile()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	if *certCN != "" {
+		if c := f.findCert(*certCN); c != nil {
+			fmt.Fprintf(os.Stderr, "❌ CN %s 已登记给客户端 %s\n", *certCN, c.Name)
+			return 1
+		}
+	}
+	token, err := f.add(name, scopes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	f.find(name).CertCN = *certCN
+	if err := writeTokensFile(f); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 无法保存 %s: %v\n", tokensFilePath(), err)
+		return 1
+	}
+	fmt.Println(token)
+	fmt.Fprintf(os.Stderr, "✓ 已添加 %s (%s)，token 只显示这一次\n", name, strings.Join(scopes, ","))
+	return 0
+}
+
+// cicy-go tui：TUI 作为客户端连接到指定地址的服务器
+func runTUIClient(args []string) int {
+	fs := flag.NewFlagSet("tui", flag.ExitOnError)
+	token := clientFlags(fs)
+	fs.Duration("ssh-timeout", appConfig.durationValue("ssh-timeout"), "SSH 模式下命令的超时时间 (0 表示不限制)")
+	parseClientFlags(fs, args)
+
+	serverURL := strings.TrimRight(appConfig.get("url"), "/")
+	if !isCicyServer(serverURL) {
+		fmt.Fprintf(os.Stderr, "❌ 无法连接到服务器: %s\n", serverURL)
+		return 1
+	}
+	runTUI(serverURL, true, resolveToken(*token))
+	return 0
+}
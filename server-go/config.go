@@ -0,0 +1,298 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 分层配置：默认值 → 配置文件 → CICY_* 环境变量 → 命令行参数
+//
+// 配置文件默认是 ~/.config/cicy/config.yaml（--config 或 CICY_CONFIG 指定其他路径），
+// 键名与命令行参数相同，tui-go 读取同一个文件：
+//
+//	port: 13001
+//	store: bolt
+//	token-file: ~/data/cicy-server.txt
+//	url: http://localhost:13001
+//
+// 环境变量为 CICY_ 加大写键名，"-" 换成 "_"，例如 CICY_STORE_PATH
+type configEntry struct {
+	key    string
+	value  string
+	source string // default / 配置文件路径 / env 变量名 / flag
+	secret bool   // config print 时隐藏
+}
+
+type config struct {
+	path    string
+	exists  bool
+	entries []*configEntry
+}
+
+// 当前生效的配置
+var appConfig = defaultConfig()
+
+func defaultConfigPath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(homeDir, ".config", "cicy", "config.yaml")
+}
+
+func defaultTokenFile() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "cicy-server.txt"
+	}
+	return filepath.Join(homeDir, "data", "cicy-server.txt")
+}
+
+func defaultTokensFile() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "cicy-tokens.json"
+	}
+	return filepath.Join(homeDir, "data", "cicy-tokens.json")
+}
+
+func defaultConfig() *config {
+	c := &config{}
+	add := func(key, value string) {
+		c.entries = append(c.entries, &configEntry{key: key, value: value, source: "default"})
+	}
+	add("port", "13001")
+	add("bind", "")
+	add("public-paths", "/health")
+	add("url", "http://localhost:13001")
+	add("token", "")
+	add("token-file", defaultTokenFile())
+	add("tokens-file", defaultTokensFile())
+	add("tls-cert", "")
+	add("tls-key", "")
+	add("tls-self-signed", "false")
+	add("tls-client-ca", "")
+	add("tls-ca", "")
+	add("tls-client-cert", "")
+	add("tls-client-key", "")
+	add("data-dir", defaultDataDir())
+	add("store", "memory")
+	add("store-path", defaultStorePath())
+	add("responder", "random")
+	add("rules", "")
+	add("openai-url", "https://api.openai.com/v1")
+	add("openai-model", "")
+	add("openai-key", "")
+	add("system-prompt", "")
+	add("prompts", defaultPromptsDir())
+	add("max-image-size", "20")
+	add("max-attachment-size", "50")
+	add("image-timeout", "30s")
+	add("ssh-timeout", "10m")
+	add("rate-limit", "10")
+	add("rate-burst", "40")
+	add("max-body-size", "1024")
+	add("max-upload-size", "100")
+	add("max-messages", "0")
+	add("max-store-size", "0")
+	add("log-file", "")
+	add("pidfile", defaultPidFile())
+
+	c.entry("token").secret = true
+	c.entry("openai-key").secret = true
+	return c
+}
+
+func (c *config) entry(key string) *configEntry {
+	for _, e := range c.entries {
+		if e.key == key {
+			return e
+		}
+	}
+	return nil
+}
+
+func (c *config) set(key, value, source string) bool {
+	e := c.entry(key)
+	if e == nil {
+		return false
+	}
+	e.value = expandHome(value)
+	e.source = source
+	return true
+}
+
+func (c *config) get(key string) string {
+	if e := c.entry(key); e != nil {
+		return e.value
+	}
+	return ""
+}
+
+// 数值配置无效时直接退出，提示值的来源
+func (c *config) intValue(key string) int {
+	n, err := strconv.Atoi(c.get(key))
+	if err != nil {
+		c.invalid(key, "需要整数")
+	}
+	return n
+}
+
+func (c *config) floatValue(key string) float64 {
+	f, err := strconv.ParseFloat(c.get(key), 64)
+	if err != nil {
+		c.invalid(key, "需要数字")
+	}
+	return f
+}
+
+func (c *config) durationValue(key string) time.Duration {
+	d, err := time.ParseDuration(c.get(key))
+	if err != nil {
+		c.invalid(key, "需要时长，例如 30s")
+	}
+	return d
+}
+
+func (c *config) boolValue(key string) bool {
+	b, err := strconv.ParseBool(c.get(key))
+	if err != nil {
+		c.invalid(key, "需要 true 或 false")
+	}
+	return b
+}
+
+func (c *config) invalid(key, reason string) {
+	e := c.entry(key)
+	fmt.Fprintf(os.Stderr, "❌ 配置 %s=%q 无效: %s (来自 %s)\n", key, e.value, reason, e.source)
+	os.Exit(2)
+}
+
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(homeDir, path[2:])
+}
+
+// 配置文件路径：--config 参数 > CICY_CONFIG > 默认路径；显式指定的文件必须存在
+func configPathFromArgs(args []string) (string, bool) {
+	for i, arg := range args {
+		for _, name := range []string{"-config", "--config"} {
+			if arg == name && i+1 < len(args) {
+				return expandHome(args[i+1]), true
+			}
+			if strings.HasPrefix(arg, name+"=") {
+				return expandHome(strings.TrimPrefix(arg, name+"=")), true
+			}
+		}
+	}
+	if path := os.Getenv("CICY_CONFIG"); path != "" {
+		return expandHome(path), true
+	}
+	return defaultConfigPath(), false
+}
+
+// 依次应用配置文件和环境变量
+func loadConfig(path string, explicit bool) (*config, error) {
+	c := defaultConfig()
+	c.path = path
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			c.exists = true
+			var values map[string]interface{}
+			if err := yaml.Unmarshal(data, &values); err != nil {
+				return nil, fmt.Errorf("解析配置文件 %s 失败: %v", path, err)
+			}
+			for key, value := range values {
+				// tui-go 使用的键是 server-go 的子集
+				if !c.set(key, fmt.Sprint(value), path) {
+					fmt.Fprintf(os.Stderr, "⚠️  配置文件中未知的键: %s\n", key)
+				}
+			}
+		case os.IsNotExist(err) && !explicit:
+		default:
+			return nil, fmt.Errorf("无法读取配置文件: %v", err)
+		}
+	}
+
+	// 兼容 OPENAI_API_KEY
+	if value := os.Getenv("OPENAI_API_KEY"); value != "" {
+		c.set("openai-key", value, "env OPENAI_API_KEY")
+	}
+	for _, e := range c.entries {
+		name := "CICY_" + strings.ToUpper(strings.ReplaceAll(e.key, "-", "_"))
+		if value := os.Getenv(name); value != "" {
+			c.set(e.key, value, "env "+name)
+		}
+	}
+
+	c.deriveURL()
+	return c, nil
+}
+
+// 未指定 url 时客户端连接配置的端口（开启 TLS 时使用 https）
+//
+// 加载配置时调用一次作为参数的默认值，应用命令行参数后再调用一次，-p / --tls-self-signed 等参数也会生效。
+// 与 tui-go/config.go 中的同名函数保持一致
+func (c *config) deriveURL() {
+	e := c.entry("url")
+	if e.source != "default" {
+		return
+	}
+	if port, err := strconv.Atoi(c.get("port")); err == nil {
+		e.value = c.localURL(port)
+	}
+}
+
+// 命令行参数的简写
+var flagAliases = map[string]string{"p": "port"}
+
+// 记录命令行中显式设置的参数
+func (c *config) applyFlags(fs *flag.FlagSet) {
+	fs.Visit(func(f *flag.Flag) {
+		key := f.Name
+		if alias, ok := flagAliases[key]; ok {
+			key = alias
+		}
+		c.set(key, f.Value.String(), "flag --"+key)
+	})
+}
+
+// config print：显示生效的配置和来源
+func (c *config) print(w io.Writer) {
+	status := ""
+	if !c.exists {
+		status = " (不存在)"
+	}
+	fmt.Fprintf(w, "# 配置文件: %s%s\n", c.path, status)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, e := range c.entries {
+		value := e.value
+		if e.secret && value != "" {
+			value = "********"
+		}
+		if value == "" {
+			value = `""`
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", e.key, value, e.source)
+	}
+	tw.Flush()
+}
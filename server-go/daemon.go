@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// 优雅退出时等待进行中请求的最长时间
+const shutdownTimeout = 10 * time.Second
+
+// 默认的 pid 文件路径
+func defaultPidFile() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "cicy-go.pid"
+	}
+	return filepath.Join(homeDir, "data", "cicy-go.pid")
+}
+
+// headless 模式：只运行 HTTP 服务器，不启动 TUI（systemd / Docker / CI）
+func runHeadless(port int, logFile, pidFile string) {
+	log.SetOutput(os.Stderr)
+	if logFile != "" {
+		f, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ 无法打开日志文件: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		log.SetOutput(f)
+	}
+
+	ready, err := startServer(port)
+	if err != nil {
+		log.Printf("❌ 服务器启动失败: %v", err)
+		os.Exit(1)
+	}
+	<-ready
+
+	if pidFile != "" {
+		if err := writePidFile(pidFile); err != nil {
+			log.Printf("⚠️  无法写入 pid 文件: %v", err)
+		} else {
+			defer os.Remove(pidFile)
+		}
+	}
+	log.Printf("🚀 headless 模式运行中 (pid %d)", os.Getpid())
+
+	// 等待 SIGINT / SIGTERM
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	log.Printf("🛑 收到信号 %v，正在关闭服务器...", <-sig)
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		log.Printf("⚠️  关闭服务器超时: %v", err)
+	}
+	log.Printf("👋 服务器已关闭")
+}
+
+func writePidFile(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644)
+}
+
+// 本机服务器地址
+func localURL(port int) string {
+	return appConfig.localURL(port)
+}
+
+func (c *config) localURL(port int) string {
+	scheme := "http"
+	if tlsEnabled(c) {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://localhost:%d", scheme, port)
+}
+
+// 地址上是否运行着 cicy 服务器（例如 headless 守护进程）
+func isCicyServer(serverURL string) bool {
+	client := &http.Client{Timeout: 2 * time.Second, Transport: httpClient.Transport}
+	resp, err := client.Get(serverURL + "/health")
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+
+	// /health 不在公开路径中时只能从认证质询判断
+	if resp.StatusCode == http.StatusUnauthorized {
+		return strings.Contains(resp.Header.Get("WWW-Authenticate"), `realm="cicy"`)
+	}
+
+	var health map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return false
+	}
+	return health["protocol"] == "mcp"
+}
+
+// 作为客户端连接到已运行的服务器：通过 GET /mcp 的 SSE 流接收新消息并显示在 TUI 中
+func attachToServer(serverURL, token string, p *tea.Program) {
+	err := followMessages(serverURL, token, func(msg Message) {
+		if tuiMsg := attachedMessage(serverURL, token, msg); tuiMsg != nil {
+			p.Send(tuiMsg)
+		}
+	})
+	if err != nil {
+		p.Send(newMessageMsg{text: fmt.Sprintf("❌ %v", err)})
+	}
+}
+
+// 订阅服务器推送的新消息（notifications/message），断开后自动重连；
+// 服务器拒绝请求（401、403 等）时返回错误，限流和 5xx 稍后重试
+func followMessages(serverURL, token string, fn func(msg Message)) error {
+	for {
+		req, _ := http.NewRequest(http.MethodGet, serverURL+"/mcp", nil)
+		req.Header.Set("Accept", "text/event-stream")
+		if token != "" {
+			setAuthHeader(req, token)
+		}
+
+		wait := 2 * time.Second
+		resp, err := httpClient.Do(req)
+		if err == nil {
+			switch {
+			case resp.StatusCode == http.StatusUnauthorized:
+				resp.Body.Close()
+				return fmt.Errorf("服务器拒绝连接: token 无效")
+			case resp.StatusCode == http.StatusTooManyRequests:
+				if retry := retryAfter(resp); retry > wait {
+					wait = retry
+				}
+			case resp.StatusCode >= 400 && resp.StatusCode < 500:
+				err := httpStatusError(resp)
+				resp.Body.Close()
+				return fmt.Errorf("服务器拒绝连接: %v", err)
+			case resp.StatusCode >= 200 && resp.StatusCode < 300:
+				readSSE(resp.Body, func(event, data string) error {
+					if msg, ok := parseMessageNotification(data); ok {
+						fn(msg)
+					}
+					return nil
+				})
+			}
+			resp.Body.Close()
+		}
+
+		// 服务器重启时自动重连
+		time.Sleep(wait)
+	}
+}
+
+// 非 2xx 响应的错误：状态码和服务器返回的错误信息（JSON 的 error 字段或纯文本）
+func httpStatusError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	detail := strings.TrimSpace(string(data))
+	var body struct {
+		Error interface{} `json:"error"`
+	}
+	if json.Unmarshal(data, &body) == nil {
+		detail = ""
+		switch e := body.Error.(type) {
+		case string:
+			detail = e
+		case map[string]interface{}:
+			// JSON-RPC 错误
+			detail, _ = e["message"].(string)
+		}
+	}
+
+	message := "HTTP " + resp.Status
+	if detail != "" && detail != http.StatusText(resp.StatusCode) {
+		message += ": " + detail
+	}
+	return errors.New(message)
+}
+
+// 429 响应的 Retry-After（秒），没有时返回 0
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func parseMessageNotification(data string) (Message, bool) {
+	var notification struct {
+		Method string `json:"method"`
+		Params struct {
+			Data Message `json:"data"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal([]byte(data), &notification); err != nil || notification.Method != "notifications/message" {
+		return Message{}, false
+	}
+	msg := notification.Params.Data
+	return msg, msg.Type != ""
+}
+
+// 把新消息转换为 TUI 消息
+func attachedMessage(serverURL, token string, msg Message) tea.Msg {
+	switch msg.Type {
+	case "text":
+		return newMessageMsg{text: msg.Text, sender: msg.Sender}
+	case "image", "attachment":
+		// 同一台机器上直接打开数据目录中的文件，否则从服务器下载
+		path := messageBlobPath(msg)
+		if _, err := os.Stat(path); err != nil {
+			if path, err = downloadBlob(serverURL, token, msg); err != nil {
+				return newMessageMsg{text: fmt.Sprintf("❌ 下载 %s 失败: %v", msg.Name, err)}
+			}
+		}
+		if msg.Type == "image" {
+			return imageMsg{path: path, size: formatSize(msg.Size), sender: msg.Sender}
+		}
+		return attachmentMsg{path: path, name: msg.Name, size: formatSize(msg.Size), sender: msg.Sender}
+	}
+	return nil
+}
+
+// 从 /api/images/{id}/raw 或 /api/attachments/{id}/raw 下载到临时目录
+func downloadBlob(serverURL, token string, msg Message) (string, error) {
+	kind := "images"
+	if msg.Type == "attachment" {
+		kind = "attachments"
+	}
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/%s/%d/raw", serverURL, kind, msg.ID), nil)
+	if err != nil {
+		return "", err
+	}
+	setAuthHeader(req, token)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	name := sanitizeFileName(msg.Name)
+	if name == "" {
+		name = fmt.Sprintf("cicy-%d", msg.ID)
+	}
+	file, err := createTempFile(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, resp.Body); err != nil {
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// 在新建的私有临时目录（0700，名字随机）中创建文件，保留原文件名；
+// 不使用可预测的路径，也不会跟随别人预先放好的符号链接
+func createTempFile(name string) (*os.File, error) {
+	dir, err := os.MkdirTemp("", "cicy-*")
+	if err != nil {
+		return nil, err
+	}
+	return os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+}
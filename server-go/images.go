@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 图片下载限制（--max-image-size / --image-timeout）
+var (
+	maxImageSize      int64 = 20 * 1024 * 1024
+	imageFetchTimeout       = 30 * time.Second
+)
+
+// 带 HTTP 状态码的 API 错误，按内容项返回给客户端
+type apiError struct {
+	status int
+	msg    string
+}
+
+func (e *apiError) Error() string {
+	return e.msg
+}
+
+func newAPIError(status int, format string, args ...interface{}) *apiError {
+	return &apiError{status: status, msg: fmt.Sprintf(format, args...)}
+}
+
+// 支持的图片格式
+type imageFormat struct {
+	mimeType string
+	ext      string
+}
+
+// 根据文件头识别图片格式
+func sniffImage(data []byte) (imageFormat, bool) {
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return imageFormat{"image/png", ".png"}, true
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return imageFormat{"image/jpeg", ".jpg"}, true
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return imageFormat{"image/gif", ".gif"}, true
+	case len(data) >= 12 && bytes.Equal(data[0:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WEBP")):
+		return imageFormat{"image/webp", ".webp"}, true
+	}
+	return imageFormat{}, false
+}
+
+// 下载文件：检查状态码，限制大小和时间；what 用于错误信息（image / file）
+func downloadFile(ctx context.Context, url string, limit int64, what string) ([]byte, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil, newAPIError(http.StatusBadRequest, "unsupported %s URL scheme", what)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, imageFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, newAPIError(http.StatusBadRequest, "invalid %s URL: %v", what, err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, newAPIError(http.StatusBadGateway, "failed to download %s: %v", what, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, newAPIError(http.StatusBadGateway, "failed to download %s: HTTP %d", what, resp.StatusCode)
+	}
+	if resp.ContentLength > limit {
+		return nil, newAPIError(http.StatusRequestEntityTooLarge, "%s too large: %s (max %s)",
+			what, formatSize(int(resp.ContentLength)), formatSize(int(limit)))
+	}
+
+	// ContentLength 可能是 -1（chunked），多读一个字节判断是否超限
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, newAPIError(http.StatusBadGateway, "failed to download %s: %v", what, err)
+	}
+	if int64(len(data)) > limit {
+		return nil, newAPIError(http.StatusRequestEntityTooLarge, "%s too large (max %s)", what, formatSize(int(limit)))
+	}
+	return data, nil
+}
+
+// 解码 base64 内容，兼容 data:...;base64, 前缀和无填充的编码
+func decodeBase64Data(data string, limit int64, what string) ([]byte, error) {
+	if strings.HasPrefix(data, "data:") {
+		if i := strings.Index(data, ","); i >= 0 {
+			data = data[i+1:]
+		}
+	}
+	data = strings.TrimSpace(data)
+
+	if int64(base64.StdEncoding.DecodedLen(len(data))) > limit+3 {
+		return nil, newAPIError(http.StatusRequestEntityTooLarge, "%s too large (max %s)", what, formatSize(int(limit)))
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		decoded, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(data, "="))
+	}
+	if err != nil {
+		return nil, newAPIError(http.StatusBadRequest, "invalid base64 %s data", what)
+	}
+	if int64(len(decoded)) > limit {
+		return nil, newAPIError(http.StatusRequestEntityTooLarge, "%s too large (max %s)", what, formatSize(int(limit)))
+	}
+	return decoded, nil
+}
+
+// 获取图片内容（URL 或 base64）并识别格式
+func fetchImage(ctx context.Context, url, data string) ([]byte, imageFormat, error) {
+	var raw []byte
+	var err error
+	switch {
+	case url != "":
+		raw, err = downloadFile(ctx, url, maxImageSize, "image")
+	case data != "":
+		raw, err = decodeBase64Data(data, maxImageSize, "image")
+	default:
+		err = newAPIError(http.StatusBadRequest, "url or data is required")
+	}
+	if err != nil {
+		return nil, imageFormat{}, err
+	}
+
+	format, ok := sniffImage(raw)
+	if !ok {
+		return nil, imageFormat{}, newAPIError(http.StatusUnsupportedMediaType, "unsupported image format (PNG, JPEG, GIF, WebP)")
+	}
+	return raw, format, nil
+}
+
+// GET /api/images/{id}      图片元数据（JSON）
+// GET /api/images/{id}/raw  图片内容
+func imageAPIHandler(w http.ResponseWriter, r *http.Request) {
+	serveBlobAPI(w, r, "/api/images/", "image", "Image")
+}
+
+// 图片和附件共用的元数据 / 内容接口
+func serveBlobAPI(w http.ResponseWriter, r *http.Request, prefix, typ, label string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeAPIError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, prefix)
+	raw := strings.HasSuffix(rest, "/raw")
+	rest = strings.TrimSuffix(rest, "/raw")
+
+	id, err := strconv.Atoi(rest)
+	if err != nil || id <= 0 {
+		writeAPIError(w, http.StatusNotFound, label+" not found")
+		return
+	}
+
+	msg, err := store.Get(id)
+	if err == errMessageNotFound || (err == nil && msg.Type != typ) {
+		writeAPIError(w, http.StatusNotFound, label+" not found")
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !raw {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":        msg.ID,
+			"type":      msg.Type,
+			"name":      msg.Name,
+			"mimeType":  msg.MimeType,
+			"size":      msg.Size,
+			"sha256":    msg.SHA256,
+			"timestamp": msg.Timestamp,
+			"url":       fmt.Sprintf("%s%d/raw", prefix, msg.ID),
+		})
+		return
+	}
+
+	data, err := readBlob(msg)
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, label+" data not found")
+		return
+	}
+
+	// 内容不可变，可以长期缓存
+	w.Header().Set("Content-Type", msg.MimeType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	if msg.SHA256 != "" {
+		w.Header().Set("ETag", `"`+msg.SHA256+`"`)
+	}
+	// MIME 类型可能由客户端指定（如 text/html），只有已知的图片格式在浏览器中直接显示
+	if typ == "attachment" || extForMimeType(msg.MimeType) == "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": msg.Name}))
+	}
+	http.ServeContent(w, r, msg.Name, msg.Timestamp, bytes.NewReader(data))
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// 只有已知的图片格式在浏览器中直接显示，客户端指定的 text/html 作为下载
+func TestServeBlobHeaders(t *testing.T) {
+	server, tokens := newTestServer(t)
+	admin := tokens[scopeAdmin]
+
+	for _, body := range []string{
+		`{"type":"image","data":"` + testPNG + `"}`,
+		`{"content":[{"type":"attachment","name":"x.html","mimeType":"text/html","data":"PHNjcmlwdD4="}]}`,
+	} {
+		if status, resp := doScopeRequest(t, server, scopeCase{method: "POST", path: "/api/message", body: body}, admin); status != http.StatusOK {
+			t.Fatalf("status = %d: %s", status, resp)
+		}
+	}
+	messages, _ := store.List()
+	imageID, htmlID := messages[0].ID, messages[1].ID
+
+	tests := []struct {
+		path        string
+		contentType string
+		disposition string
+	}{
+		{"/api/images/" + strconv.Itoa(imageID) + "/raw", "image/png", ""},
+		{"/api/attachments/" + strconv.Itoa(htmlID) + "/raw", "text/html", "attachment"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", server.URL+tt.path, nil)
+		setAuthHeader(req, admin)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: status = %d", tt.path, resp.StatusCode)
+		}
+		if got := resp.Header.Get("Content-Type"); got != tt.contentType {
+			t.Errorf("%s: Content-Type = %q, want %q", tt.path, got, tt.contentType)
+		}
+		if got := resp.Header.Get("X-Content-Type-Options"); got != "nosniff" {
+			t.Errorf("%s: X-Content-Type-Options = %q", tt.path, got)
+		}
+		if got, _, _ := strings.Cut(resp.Header.Get("Content-Disposition"), ";"); got != tt.disposition {
+			t.Errorf("%s: Content-Disposition = %q, want %q", tt.path, got, tt.disposition)
+		}
+	}
+}
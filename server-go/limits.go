@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 限流和大小限制
+//
+//   - 每个客户端（token 名字，没有 token 时按 IP）一个令牌桶：--rate-limit 每秒补充的请求数，--rate-burst 桶容量
+//   - 认证失败的请求在返回 401 之前消耗来源 IP 的令牌，猜测 token 同样受限流
+//   - 请求体大小：/api/message 受 --max-upload-size（MB）限制，其他端点受 --max-body-size（KB）限制
+//   - 存储上限：--max-messages 条数和 --max-store-size 总字节数（包括图片和附件），超出时删除最旧的消息和不再被引用的文件
+//
+// 超出限流时返回 429 和 Retry-After；/mcp 返回 JSON-RPC 错误，data.retryAfter 为需要等待的秒数
+var (
+	rateLimit     float64 = 10 // 每秒请求数，0 表示不限流
+	rateBurst             = 40
+	maxBodySize   int64   = 1024 << 10
+	maxUploadSize int64   = 100 << 20
+	maxMessages           = 0 // 0 表示不限制
+	maxStoreSize  int64   = 0
+)
+
+// JSON-RPC 限流错误码（实现自定义范围）
+const rpcRateLimited = -32029
+
+// 空闲超过该时间的令牌桶会被清理
+const bucketIdleTimeout = 10 * time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+var limiter = struct {
+	sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}{buckets: map[string]*bucket{}}
+
+// 消耗一个令牌；桶空时返回需要等待的时间
+func takeToken(key string, now time.Time) (bool, time.Duration) {
+	if rateLimit <= 0 {
+		return true, 0
+	}
+	limiter.Lock()
+	defer limiter.Unlock()
+
+	if now.Sub(limiter.lastPrune) > time.Minute {
+		for k, b := range limiter.buckets {
+			if now.Sub(b.last) > bucketIdleTimeout {
+				delete(limiter.buckets, k)
+			}
+		}
+		limiter.lastPrune = now
+	}
+
+	b := limiter.buckets[key]
+	if b == nil {
+		b = &bucket{tokens: float64(rateBurst), last: now}
+		limiter.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(rateBurst), b.tokens+now.Sub(b.last).Seconds()*rateLimit)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / rateLimit * float64(time.Second))
+}
+
+// 限流的 key：已认证的客户端按名字，否则按来源 IP
+func limitKey(r *http.Request) string {
+	if c := clientFromContext(r.Context()); c != nil {
+		return "client:" + c.Name
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func bodyLimit(r *http.Request) int64 {
+	if r.URL.Path == "/api/message" {
+		return maxUploadSize
+	}
+	return maxBodySize
+}
+
+// 在认证之后执行：限流并限制请求体大小（认证失败的请求在 authHandler 中按 IP 限流）
+func limitHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, wait := takeToken(limitKey(r), time.Now()); !ok {
+			writeRateLimited(w, r, wait)
+			return
+		}
+		if r.ContentLength > bodyLimit(r) {
+			writeBodyTooLarge(w, r)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, bodyLimit(r))
+		next.ServeHTTP(w, r)
+	})
+}
+
+func retryAfterSeconds(wait time.Duration) int {
+	return int(math.Ceil(wait.Seconds()))
+}
+
+func writeRateLimited(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	seconds := retryAfterSeconds(wait)
+	log.Printf("⏳ 限流: %s %s (%s)", r.Method, r.URL.Path, limitKey(r))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+
+	if r.URL.Path == "/mcp" && r.Method == http.MethodPost {
+		// 尽量取出请求 ID，客户端可以对应到具体的调用
+		var req JSONRPCRequest
+		json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&req)
+		resp := newRPCError(req.ID, rpcRateLimited, fmt.Sprintf("Rate limit exceeded, retry after %ds", seconds))
+		resp.Error.Data = map[string]interface{}{"retryAfter": seconds}
+		writeRPCStatus(w, http.StatusTooManyRequests, resp)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    false,
+		"error":      fmt.Sprintf("rate limit exceeded, retry after %ds", seconds),
+		"retryAfter": seconds,
+	})
+}
+
+func writeBodyTooLarge(w http.ResponseWriter, r *http.Request) {
+	message := fmt.Sprintf("request body too large (max %s)", formatSize(int(bodyLimit(r))))
+	if r.URL.Path == "/mcp" {
+		writeRPCStatus(w, http.StatusRequestEntityTooLarge, newRPCError(nil, -32600, message))
+		return
+	}
+	writeAPIError(w, http.StatusRequestEntityTooLarge, message)
+}
+
+func writeRPCStatus(w http.ResponseWriter, status int, resp *JSONRPCResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func isBodyTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
+
+// 存储中的消息占用的字节数
+func messageBytes(msg Message) int64 {
+	return int64(len(msg.Text) + len(msg.Data) + msg.Size)
+}
+
+// 超出 --max-messages / --max-store-size 时从最旧的消息开始删除
+func enforceStoreLimits() {
+	if maxMessages <= 0 && maxStoreSize <= 0 {
+		return
+	}
+	evicted, err := store.Trim(maxMessages, maxStoreSize)
+	if err != nil {
+		log.Printf("❌ 删除超出存储上限的消息失败: %v", err)
+		return
+	}
+	if len(evicted) > 0 {
+		removeUnusedBlobs(evicted)
+		log.Printf("🧹 超出存储上限，删除了 %d 条最旧的消息", len(evicted))
+		broadcastNotification("notifications/resources/list_changed", nil)
+	}
+}
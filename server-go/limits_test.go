@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// 认证失败的请求按来源 IP 限流，超出后返回 429
+func TestRateLimitUnauthenticated(t *testing.T) {
+	server, tokens := newTestServer(t)
+	savedBurst := rateBurst
+	t.Cleanup(func() { rateBurst = savedBurst })
+	rateLimit, rateBurst = 1, 5
+	limiter.Lock()
+	limiter.buckets = map[string]*bucket{}
+	limiter.Unlock()
+
+	req := scopeCase{method: "GET", path: "/messages"}
+	statuses := map[int]int{}
+	for i := 0; i < 20; i++ {
+		status, _ := doScopeRequest(t, server, req, "wrong-token")
+		statuses[status]++
+	}
+	if statuses[http.StatusUnauthorized] > rateBurst+1 || statuses[http.StatusTooManyRequests] == 0 {
+		t.Errorf("statuses = %v, want at most %d × 401 then 429", statuses, rateBurst+1)
+	}
+
+	// 有效 token 按客户端名字限流，不受同一 IP 上失败请求的影响
+	if status, body := doScopeRequest(t, server, req, tokens[scopeMessagesRead]); status != http.StatusOK {
+		t.Errorf("valid token: status = %d: %s", status, body)
+	}
+}
+
+// 删除消息时删除不再被引用的文件，相同内容的其他消息还在时保留
+func TestStoreLimitsRemoveBlobs(t *testing.T) {
+	server, tokens := newTestServer(t)
+	savedMax := maxMessages
+	t.Cleanup(func() { maxMessages = savedMax })
+	maxMessages = 2
+
+	admin := tokens[scopeAdmin]
+	image := scopeCase{method: "POST", path: "/api/message", body: `{"type":"image","data":"` + testPNG + `"}`}
+	text := scopeCase{method: "POST", path: "/api/message", body: `{"type":"text","text":"hi"}`}
+	post := func(c scopeCase) {
+		t.Helper()
+		if status, body := doScopeRequest(t, server, c, admin); status != http.StatusOK {
+			t.Fatalf("status = %d: %s", status, body)
+		}
+	}
+
+	post(image)
+	post(image)
+	messages, _ := store.List()
+	path := messageBlobPath(messages[0])
+	if !fileExists(path) {
+		t.Fatalf("blob %s not written", path)
+	}
+
+	post(text) // 删除第一张图片，第二张还引用同一个文件
+	if !fileExists(path) {
+		t.Error("blob removed while still referenced")
+	}
+	post(text) // 删除第二张图片
+	if fileExists(path) {
+		t.Error("unreferenced blob not removed after eviction")
+	}
+
+	// clear_messages 同样删除文件
+	maxMessages = 0
+	attachment := scopeCase{method: "POST", path: "/api/message", body: `{"content":[{"type":"attachment","name":"a.txt","data":"aGk="}]}`}
+	post(attachment)
+	messages, _ = store.List()
+	path = messageBlobPath(messages[len(messages)-1])
+	if !fileExists(path) {
+		t.Fatalf("attachment %s not written", path)
+	}
+	clearAll := scopeCase{method: "POST", path: "/mcp", body: toolCall("clear_messages", `{}`)}
+	post(clearAll)
+	if fileExists(path) {
+		t.Error("attachment blob not removed after clear_messages")
+	}
+}
+
+// TUI 发送消息被拒绝时显示错误而不是默认回复
+func TestSendMessageToServerErrors(t *testing.T) {
+	server, tokens := newTestServer(t)
+
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{"unauthorized", "wrong-token", "错误: token 无效"},
+		{"forbidden", tokens[scopeMessagesRead], `错误: HTTP 403 Forbidden: token "messages-read" lacks scope messages:write`},
+	}
+	for _, tt := range tests {
+		if reply := sendMessageToServer("hi", server.URL, tt.token, func(string) {}); reply != tt.want {
+			t.Errorf("%s: reply = %q, want %q", tt.name, reply, tt.want)
+		}
+	}
+
+	savedBurst := rateBurst
+	t.Cleanup(func() { rateBurst = savedBurst })
+	rateLimit, rateBurst = 0.01, 1
+	limiter.Lock()
+	limiter.buckets = map[string]*bucket{}
+	limiter.Unlock()
+
+	if reply := sendMessageToServer("hi", server.URL, tokens[scopeMessagesWrite], func(string) {}); strings.HasPrefix(reply, "错误") {
+		t.Errorf("first message: reply = %q", reply)
+	}
+	want := "错误: 请求过于频繁，100 秒后重试"
+	if reply := sendMessageToServer("hi", server.URL, tokens[scopeMessagesWrite], func(string) {}); reply != want {
+		t.Errorf("rate limited: reply = %q, want %q", reply, want)
+	}
+}
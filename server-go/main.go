@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
@@ -13,8 +14,8 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -51,31 +52,26 @@ var (
 	inputStyle = lipgloss.NewStyle().
 			Foreground(primaryColor).
 			Bold(true)
+
+	stderrStyle = lipgloss.NewStyle().
+			Foreground(errorColor)
 )
 
-// 消息存储
+// 消息存储（文本、图片和附件共用一个结构）
 type Message struct {
 	Type      string    `json:"type"`
 	Text      string    `json:"text,omitempty"`
+	Name      string    `json:"name,omitempty"`
+	MimeType  string    `json:"mimeType,omitempty"`
+	Data      string    `json:"data,omitempty"`   // 图片 base64（旧版本记录）
+	SHA256    string    `json:"sha256,omitempty"` // 附件内容的 SHA-256
+	Size      int       `json:"size,omitempty"`   // 图片 / 附件字节数
+	Sender    string    `json:"sender,omitempty"` // 发送消息的客户端（token 名字）
 	Timestamp time.Time `json:"timestamp"`
 	ID        int       `json:"id"`
 }
 
-type Image struct {
-	Type      string    `json:"type"`
-	Name      string    `json:"name"`
-	MimeType  string    `json:"mimeType"`
-	Data      string    `json:"data"`
-	Timestamp time.Time `json:"timestamp"`
-	ID        int       `json:"id"`
-}
-
-var (
-	messages []Message
-	images   []Image
-	msgMutex sync.RWMutex
-	authToken string
-)
+var authToken string
 
 // MCP 工具定义
 type Tool struct {
@@ -101,10 +97,42 @@ var tools = []Tool{
 	},
 	{
 		Name:        "get_messages",
-		Description: "Get all messages from the server",
+		Description: "Get messages from the server, oldest first. Results are paginated; pass nextCursor back as cursor to get the next page",
 		InputSchema: map[string]interface{}{
-			"type":       "object",
-			"properties": map[string]interface{}{},
+			"type": "object",
+			"properties": map[string]interface{}{
+				"after_id": map[string]interface{}{
+					"type":        "integer",
+					"description": "Only return messages with an ID greater than this (last seen ID)",
+				},
+				"cursor": map[string]interface{}{
+					"type":        "string",
+					"description": "Opaque pagination cursor from a previous nextCursor",
+				},
+				"limit": map[string]interface{}{
+					"type":        "integer",
+					"description": fmt.Sprintf("Maximum number of messages to return (default %d, max %d)", defaultPageSize, maxPageSize),
+				},
+				"since": map[string]interface{}{
+					"type":        "string",
+					"format":      "date-time",
+					"description": "Only messages at or after this RFC3339 timestamp",
+				},
+				"until": map[string]interface{}{
+					"type":        "string",
+					"format":      "date-time",
+					"description": "Only messages before this RFC3339 timestamp",
+				},
+				"type": map[string]interface{}{
+					"type":        "string",
+					"enum":        []string{"text", "image", "attachment", "all"},
+					"description": "Message type to return (default text)",
+				},
+				"query": map[string]interface{}{
+					"type":        "string",
+					"description": "Only messages whose text contains this substring",
+				},
+			},
 		},
 	},
 	{
@@ -147,35 +175,17 @@ func generateToken() string {
 
 // 加载或生成 token
 func loadOrGenerateToken() string {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		log.Printf("无法获取用户目录: %v", err)
-		return generateToken()
-	}
-
-	dataDir := filepath.Join(homeDir, "data")
-	tokenFile := filepath.Join(dataDir, "cicy-server.txt")
+	tokenFile := tokenFilePath()
 
 	// 读取现有 token
-	if data, err := os.ReadFile(tokenFile); err == nil {
-		token := strings.TrimSpace(string(data))
-		if token != "" {
-			log.Printf("已加载 token: %s", tokenFile)
-			return token
-		}
-	}
-
-	// 生成新 token
-	token := generateToken()
-	
-	// 创建目录
-	if err := os.MkdirAll(dataDir, 0755); err != nil {
-		log.Printf("无法创建目录: %v", err)
+	if token := readTokenFile(); token != "" {
+		log.Printf("已加载 token: %s", tokenFile)
 		return token
 	}
 
-	// 保存 token
-	if err := os.WriteFile(tokenFile, []byte(token), 0600); err != nil {
+	// 生成并保存新 token
+	token := generateToken()
+	if err := writeTokenFile(token); err != nil {
 		log.Printf("无法保存 token: %v", err)
 	} else {
 		log.Printf("已生成新 token: %s", tokenFile)
@@ -184,33 +194,15 @@ func loadOrGenerateToken() string {
 	return token
 }
 
-// 验证 token 中间件
-func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		token := r.Header.Get("Authorization")
-		if token == "" {
-			token = r.Header.Get("X-Auth-Token")
-		}
-		
-		// 移除 "Bearer " 前缀
-		token = strings.TrimPrefix(token, "Bearer ")
-		
-		if token != authToken {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-		
-		next(w, r)
-	}
-}
-
 // API 消息结构
 type APIMessage struct {
-	Type    string                   `json:"type"` // "text" or "image"
-	Text    string                   `json:"text,omitempty"`
-	URL     string                   `json:"url,omitempty"`
-	Data    string                   `json:"data,omitempty"` // base64
-	Content []map[string]interface{} `json:"content,omitempty"` // MCP 格式
+	Type     string                   `json:"type"` // "text" / "image" / "attachment"
+	Text     string                   `json:"text,omitempty"`
+	URL      string                   `json:"url,omitempty"`
+	Data     string                   `json:"data,omitempty"`     // base64
+	Name     string                   `json:"name,omitempty"`     // 附件文件名
+	MimeType string                   `json:"mimeType,omitempty"` // 附件 MIME 类型
+	Content  []map[string]interface{} `json:"content,omitempty"`  // MCP 格式
 }
 
 // 全局 program 变量，用于发送消息到 TUI
@@ -218,222 +210,222 @@ var tuiProgram *tea.Program
 
 // 图片消息结构
 type imageMsg struct {
-	path string
-	size string
+	path   string
+	size   string
+	sender string
 }
 
 // API 处理器
 func apiHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeAPIError(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	var msg APIMessage
 	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		if isBodyTooLarge(err) {
+			writeBodyTooLarge(w, r)
+			return
+		}
+		writeAPIError(w, http.StatusBadRequest, "Invalid JSON")
 		return
 	}
 
-	msgMutex.Lock()
-	defer msgMutex.Unlock()
-
-	// 处理 MCP content 数组格式
+	// 处理 MCP content 数组格式，每一项单独返回结果
 	if len(msg.Content) > 0 {
-		for _, item := range msg.Content {
-			itemType, _ := item["type"].(string)
-			
-			switch itemType {
-			case "text":
-				text, _ := item["text"].(string)
-				if text != "" {
-					messages = append(messages, Message{
-						Type:      "text",
-						Text:      text,
-						Timestamp: time.Now(),
-						ID:        len(messages) + 1,
-					})
-					log.Printf("📝 收到文本消息: %s", text)
-					
-					// 发送消息到 TUI
-					if tuiProgram != nil {
-						tuiProgram.Send(newMessageMsg{text: text})
-					}
-				}
-				
-			case "image":
-				imageURL, _ := item["url"].(string)
-				imageData, _ := item["data"].(string)
-				
-				if imageURL == "" && imageData == "" {
-					continue
-				}
-				
-				finalData := imageData
-				imageSize := len(imageData)
-				
-				if imageURL != "" {
-					// 从 URL 下载图片
-					resp, err := http.Get(imageURL)
-					if err != nil {
-						log.Printf("❌ 下载图片失败: %v", err)
-						continue
-					}
-					defer resp.Body.Close()
-
-					var buf []byte
-					buf = make([]byte, resp.ContentLength)
-					resp.Body.Read(buf)
-					finalData = base64.StdEncoding.EncodeToString(buf)
-					imageSize = len(buf)
-				} else {
-					decoded, _ := base64.StdEncoding.DecodeString(imageData)
-					imageSize = len(decoded)
-				}
-
-				images = append(images, Image{
-					Type:      "image",
-					Name:      fmt.Sprintf("image_%d", len(images)+1),
-					MimeType:  "image/png",
-					Data:      finalData,
-					Timestamp: time.Now(),
-					ID:        len(images) + 1,
-				})
-				
-				sizeStr := formatSize(imageSize)
-				log.Printf("🖼️  收到图片消息 (大小: %s)", sizeStr)
-				
-				// 保存图片到文件
-				imagePath, err := saveImageToFile(finalData)
-				if err != nil {
-					log.Printf("❌ 保存图片失败: %v", err)
-					continue
-				}
-				
-				// 发送图片消息到 TUI
-				if tuiProgram != nil {
-					tuiProgram.Send(imageMsg{path: imagePath, size: sizeStr})
-				}
+		results := make([]map[string]interface{}, 0, len(msg.Content))
+		stored := 0
+		var lastErr *apiError
+		for i, item := range msg.Content {
+			saved, err := ingestContentItem(r.Context(), item)
+			result := map[string]interface{}{"index": i, "type": item["type"]}
+			if err != nil {
+				log.Printf("❌ 内容项 %d 处理失败: %v", i, err)
+				lastErr = asAPIError(err)
+				result["success"] = false
+				result["error"] = lastErr.msg
+			} else {
+				stored++
+				result["success"] = true
+				result["id"] = saved.ID
 			}
+			results = append(results, result)
+		}
+
+		// 全部失败时使用最后一个错误的状态码
+		status := http.StatusOK
+		if stored == 0 && lastErr != nil {
+			status = lastErr.status
 		}
-		
 		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": true,
-			"message": "Message received",
+			"success": stored == len(msg.Content),
+			"message": fmt.Sprintf("%d/%d items received", stored, len(msg.Content)),
+			"results": results,
 		})
 		return
 	}
 
 	// 处理旧格式（单个消息）
-	switch msg.Type {
+	saved, err := ingestContentItem(r.Context(), map[string]interface{}{
+		"type":     msg.Type,
+		"text":     msg.Text,
+		"url":      msg.URL,
+		"data":     msg.Data,
+		"name":     msg.Name,
+		"mimeType": msg.MimeType,
+	})
+	if err != nil {
+		log.Printf("❌ 消息处理失败: %v", err)
+		apiErr := asAPIError(err)
+		writeAPIError(w, apiErr.status, apiErr.msg)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Message received",
+		"id":      saved.ID,
+	})
+}
+
+// 处理一个 content 项（text / image / attachment / resource）
+func ingestContentItem(ctx context.Context, item map[string]interface{}) (Message, error) {
+	itemType, _ := item["type"].(string)
+
+	switch itemType {
 	case "text":
-		if msg.Text == "" {
-			http.Error(w, "Text is required", http.StatusBadRequest)
-			return
+		text, _ := item["text"].(string)
+		if text == "" {
+			return Message{}, newAPIError(http.StatusBadRequest, "text is required")
 		}
-		messages = append(messages, Message{
-			Type:      "text",
-			Text:      msg.Text,
-			Timestamp: time.Now(),
-			ID:        len(messages) + 1,
-		})
-		log.Printf("📝 收到文本消息: %s", msg.Text)
-		
-		// 发送消息到 TUI
-		if tuiProgram != nil {
-			tuiProgram.Send(newMessageMsg{text: msg.Text})
+		if err := requireScope(ctx, scopeMessagesWrite); err != nil {
+			return Message{}, err
 		}
+		return addTextMessage(ctx, text)
 
 	case "image":
-		if msg.URL == "" && msg.Data == "" {
-			http.Error(w, "URL or Data is required", http.StatusBadRequest)
-			return
+		if err := requireScope(ctx, scopeImagesWrite); err != nil {
+			return Message{}, err
 		}
-		
-		imageData := msg.Data
-		imageSize := len(msg.Data)
-		
-		if msg.URL != "" {
-			resp, err := http.Get(msg.URL)
-			if err != nil {
-				http.Error(w, "Failed to download image", http.StatusBadRequest)
-				return
-			}
-			defer resp.Body.Close()
-
-			var buf []byte
-			buf = make([]byte, resp.ContentLength)
-			resp.Body.Read(buf)
-			imageData = base64.StdEncoding.EncodeToString(buf)
-			imageSize = len(buf)
-		} else {
-			decoded, _ := base64.StdEncoding.DecodeString(msg.Data)
-			imageSize = len(decoded)
-		}
-
-		images = append(images, Image{
-			Type:      "image",
-			Name:      fmt.Sprintf("image_%d", len(images)+1),
-			MimeType:  "image/png",
-			Data:      imageData,
-			Timestamp: time.Now(),
-			ID:        len(images) + 1,
-		})
-		
-		sizeStr := formatSize(imageSize)
-		log.Printf("🖼️  收到图片消息 (大小: %s)", sizeStr)
-		
-		// 保存图片到文件
-		imagePath, err := saveImageToFile(imageData)
+		imageURL, _ := item["url"].(string)
+		imageData, _ := item["data"].(string)
+		data, format, err := fetchImage(ctx, imageURL, imageData)
 		if err != nil {
-			log.Printf("❌ 保存图片失败: %v", err)
-			http.Error(w, "Failed to save image", http.StatusInternalServerError)
-			return
+			return Message{}, err
 		}
-		
-		// 发送图片消息到 TUI
-		if tuiProgram != nil {
-			tuiProgram.Send(imageMsg{path: imagePath, size: sizeStr})
+		return addImageMessage(ctx, data, format)
+
+	case "attachment", "resource":
+		if err := requireScope(ctx, scopeImagesWrite); err != nil {
+			return Message{}, err
 		}
+		return ingestAttachment(ctx, item)
 
 	default:
-		http.Error(w, "Invalid type", http.StatusBadRequest)
-		return
+		return Message{}, newAPIError(http.StatusBadRequest, "invalid type: %q", itemType)
+	}
+}
+
+func asAPIError(err error) *apiError {
+	if apiErr, ok := err.(*apiError); ok {
+		return apiErr
 	}
+	return &apiError{status: http.StatusInternalServerError, msg: err.Error()}
+}
 
+func writeAPIError(w http.ResponseWriter, status int, message string) {
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"message": "Message received",
+		"success": false,
+		"error":   message,
 	})
 }
 
-// 保存图片到临时文件
-func saveImageToFile(base64Data string) (string, error) {
-	// 解码 base64
-	decoded, err := base64.StdEncoding.DecodeString(base64Data)
+// 写入存储并通知订阅了资源的 MCP 客户端和 WebSocket 客户端
+// 发送者取自 ctx 中认证的客户端
+func appendMessage(ctx context.Context, msg Message) (Message, error) {
+	msg.Sender = senderFromContext(ctx)
+	msg, err := store.Append(msg)
 	if err != nil {
-		return "", err
+		return msg, err
 	}
-	
-	// 创建目录
-	homeDir, _ := os.UserHomeDir()
-	imageDir := filepath.Join(homeDir, "Desktop", "images")
-	os.MkdirAll(imageDir, 0755)
-	
-	// 生成文件名（使用时间戳）
-	timestamp := time.Now().Format("20060102_150405")
-	filename := fmt.Sprintf("image_%s.png", timestamp)
-	filepath := filepath.Join(imageDir, filename)
-	
-	// 保存文件
-	err = os.WriteFile(filepath, decoded, 0644)
+	notifyResourceAdded(msg)
+	publishMessage(ctx, msg)
+	enforceStoreLimits()
+	return msg, nil
+}
+
+// 保存收到的文本消息，并通知 TUI 和 MCP 客户端
+func addTextMessage(ctx context.Context, text string) (Message, error) {
+	msg, err := appendMessage(ctx, Message{
+		Type:      "text",
+		Text:      text,
+		Timestamp: time.Now(),
+	})
 	if err != nil {
-		return "", err
+		return msg, err
+	}
+	log.Printf("📝 收到文本消息: %s", text)
+
+	// 发送消息到 TUI
+	if tuiProgram != nil {
+		tuiProgram.Send(newMessageMsg{text: text, sender: msg.Sender})
+	}
+	broadcastLog("info", msg)
+	return msg, nil
+}
+
+// 保存收到的图片（按内容寻址），并通知 TUI 和 MCP 客户端
+func addImageMessage(ctx context.Context, data []byte, format imageFormat) (Message, error) {
+	imageSize := len(data)
+
+	sum, imagePath, err := putBlob(data, format.ext)
+	if err != nil {
+		return Message{}, fmt.Errorf("保存图片失败: %v", err)
+	}
+
+	msg, err := appendMessage(ctx, Message{
+		Type:      "image",
+		Name:      fmt.Sprintf("image_%s%s", sum[:12], format.ext),
+		MimeType:  format.mimeType,
+		SHA256:    sum,
+		Size:      imageSize,
+		Timestamp: time.Now(),
+	})
+	unpinBlob(imagePath)
+	if err != nil {
+		removeUnusedBlobs([]Message{msg})
+		return msg, err
+	}
+
+	sizeStr := formatSize(imageSize)
+	log.Printf("🖼️  收到图片消息 (%s, 大小: %s)", format.mimeType, sizeStr)
+	broadcastLog("info", imageNotice(msg, imageSize))
+
+	// 发送图片消息到 TUI
+	if tuiProgram != nil {
+		tuiProgram.Send(imageMsg{path: imagePath, size: sizeStr, sender: msg.Sender})
+	}
+	return msg, nil
+}
+
+// 图片 / 附件通知内容（不包含文件数据）
+func imageNotice(img Message, size int) map[string]interface{} {
+	return map[string]interface{}{
+		"type":      img.Type,
+		"id":        img.ID,
+		"name":      img.Name,
+		"mimeType":  img.MimeType,
+		"sha256":    img.SHA256,
+		"size":      size,
+		"sender":    img.Sender,
+		"timestamp": img.Timestamp,
 	}
-	
-	return filepath, nil
 }
 
 // 格式化文件大小
@@ -447,6 +439,14 @@ func formatSize(size int) string {
 	return fmt.Sprintf("%d bytes", size)
 }
 
+// TUI 中显示消息的发送者
+func sentBy(sender string) string {
+	if sender == "" {
+		return ""
+	}
+	return statusStyle.Render(" — 来自 " + sender)
+}
+
 // 在终端显示图片（iTerm2 内联图片协议）
 func displayImageInTerminal(base64Data string) {
 	// iTerm2 图片协议格式
@@ -497,21 +497,26 @@ func getRandomResponse() string {
 
 // TUI Model
 type model struct {
-	input        string
-	messages     []string
-	pendingImage string // 待打开的图片路径
-	loading      bool
-	loadingDots  int
-	startTime    time.Time
-	width        int
-	height       int
-	serverPort   int
-	ctrlCCount   int
-	lastCtrlC    time.Time
-	sshMode      bool
-	sshHosts     []string
-	sshSelected  int
-	sshConnected string // 已连接的 SSH 主机
+	input         string
+	messages      []string
+	pendingImage  string // 待打开的图片 / 附件路径
+	loading       bool
+	loadingDots   int
+	partial       string // 正在流式接收的回复
+	startTime     time.Time
+	width         int
+	height        int
+	serverURL     string // 服务器地址，空表示服务器未启动
+	token         string // 访问服务器的 token
+	ctrlCCount    int
+	lastCtrlC     time.Time
+	sshMode       bool
+	sshHosts      []sshHostConfig
+	sshSelected   int
+	sshConnected  string // 已连接的 SSH 主机
+	sshCwd        string // 远程 shell 的当前目录
+	sshRunning    bool   // 远程命令正在执行，Ctrl+C 中断它而不是退出
+	sshInterrupts int    // 当前命令已按的 Ctrl+C 次数，第二次强制终止
 }
 
 type tickMsg time.Time
@@ -520,10 +525,14 @@ type responseMsg struct {
 	duration time.Duration
 }
 type newMessageMsg struct {
+	text   string
+	sender string
+}
+type streamChunkMsg struct {
 	text string
 }
 
-func initialModel(port int) model {
+func initialModel(serverURL, token string, attached bool) model {
 	// ASCII Logo - 更宽更大
 	logo := []string{
 		"",
@@ -543,14 +552,18 @@ func initialModel(port int) model {
 	messages := make([]string, len(logo))
 	copy(messages, logo)
 	
-	if port != 0 {
-		messages = append(messages, fmt.Sprintf("        🚀 服务器已启动 (端口: %d)", port))
+	if attached {
+		messages = append(messages, fmt.Sprintf("        🔗 已连接到服务器 (%s)", serverURL))
+		messages = append(messages, "")
+	} else if serverURL != "" {
+		messages = append(messages, fmt.Sprintf("        🚀 服务器已启动 (%s)", serverURL))
 		messages = append(messages, "")
 	}
 	
 	return model{
-		messages:   messages,
-		serverPort: port,
+		messages:  messages,
+		serverURL: serverURL,
+		token:     token,
 	}
 }
 
@@ -589,11 +602,13 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			
 			case "enter":
 				if m.sshSelected < len(m.sshHosts) {
-					selected := m.sshHosts[m.sshSelected]
-					m.sshConnected = selected
-					m.messages = append(m.messages, fmt.Sprintf("✓ 已连接到: %s", selected))
+					selected := m.sshHosts[m.sshSelected].Alias
+					m.messages = append(m.messages, statusStyle.Render(fmt.Sprintf("  正在连接 %s...", selected)))
 					m.sshMode = false
 					m.input = ""
+					m.loading = true
+					m.startTime = time.Now()
+					return m, tea.Batch(tickCmd(), sshConnectCmd(selected))
 				} else {
 					// 调试：显示索引信息
 					m.messages = append(m.messages, fmt.Sprintf("错误: 索引 %d >= 长度 %d", m.sshSelected, len(m.sshHosts)))
@@ -606,6 +621,17 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		// 正常模式下的按键处理
 		switch msg.String() {
 		case "ctrl+c":
+			if m.sshRunning {
+				m.sshInterrupts++
+				if m.sshInterrupts == 1 {
+					m.messages = append(m.messages, statusStyle.Render("  ^C 已发送中断，再按一次终止 shell"))
+				} else {
+					m.messages = append(m.messages, statusStyle.Render("  ^C 终止 shell"))
+				}
+				interruptSSHCommand(m.sshInterrupts > 1)
+				return m, nil
+			}
+
 			now := time.Now()
 			// 如果距离上次 Ctrl+C 超过 2 秒，重置计数
 			if now.Sub(m.lastCtrlC) > 2*time.Second {
@@ -630,7 +656,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			// 打开待查看的图片
 			if m.pendingImage != "" {
 				go openImage(m.pendingImage)
-				m.messages = append(m.messages, statusStyle.Render("  ✓ 已打开图片"))
+				m.messages = append(m.messages, statusStyle.Render("  ✓ 已打开"))
 				m.pendingImage = ""
 			}
 			return m, nil
@@ -658,15 +684,35 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			// 处理 /exit 命令（断开 SSH）
 			if m.input == "/exit" && m.sshConnected != "" {
 				m.messages = append(m.messages, fmt.Sprintf("✓ 已断开: %s", m.sshConnected))
+				sshDisconnect(m.sshConnected)
 				m.sshConnected = ""
+				m.sshCwd = ""
 				m.input = ""
 				return m, nil
 			}
 
-			// 如果已连接 SSH，转发命令
+			// 处理 /shell 命令（全屏 PTY shell）
+			if m.input == "/shell" {
+				m.input = ""
+				if m.sshConnected == "" {
+					m.messages = append(m.messages, statusStyle.Render("  /shell 需要先用 /ssh 连接主机"))
+					return m, nil
+				}
+				if m.sshRunning {
+					return m, nil
+				}
+				return m, openPtyShell(m.sshConnected, m.width, m.height)
+			}
+
+			// 如果已连接 SSH，转发命令（上一条命令结束前不接受新命令）
 			if m.sshConnected != "" {
+				if m.sshRunning {
+					return m, nil
+				}
 				m.messages = append(m.messages, fmt.Sprintf("$ %s", m.input))
 				m.loading = true
+				m.sshRunning = true
+				m.sshInterrupts = 0
 				m.startTime = time.Now()
 
 				cmd := m.input
@@ -676,16 +722,14 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, tea.Batch(
 					tickCmd(),
 					func() tea.Msg {
-						// 执行 SSH 命令
-						output := executeSSHCommand(host, cmd)
-						duration := time.Since(m.startTime)
-						return responseMsg{text: output, duration: duration}
+						// 在远程 shell 中执行命令，输出通过 sshOutputMsg 逐行显示
+						return executeSSHCommand(host, cmd)
 					},
 				)
 			}
 
 			// 检查服务器是否启动
-			if m.serverPort == 0 {
+			if m.serverURL == "" {
 				m.messages = append(m.messages, fmt.Sprintf("你: %s", m.input))
 				m.messages = append(m.messages, "❌ 错误: 服务器未启动，无法发送消息")
 				m.input = ""
@@ -703,8 +747,12 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, tea.Batch(
 				tickCmd(),
 				func() tea.Msg {
-					// 调用本地 API
-					resp := sendMessageToServer(input, m.serverPort)
+					// 调用本地 API，流式回复逐段推送到 TUI
+					resp := sendMessageToServer(input, m.serverURL, m.token, func(chunk string) {
+						if tuiProgram != nil {
+							tuiProgram.Send(streamChunkMsg{text: chunk})
+						}
+					})
 					duration := time.Since(m.startTime)
 					return responseMsg{text: resp, duration: duration}
 				},
@@ -727,8 +775,15 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, tickCmd()
 		}
 
+	case streamChunkMsg:
+		if m.loading {
+			m.partial += msg.text
+		}
+		return m, nil
+
 	case responseMsg:
 		m.loading = false
+		m.partial = ""
 		// 处理多行回复
 		lines := strings.Split(msg.text, "\n")
 		for _, line := range lines {
@@ -739,18 +794,70 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.messages = append(m.messages, statusStyle.Render(fmt.Sprintf("  - %.2f", seconds)))
 		return m, nil
 	
+	case sshConnectedMsg:
+		m.loading = false
+		if msg.err != nil {
+			m.messages = append(m.messages, fmt.Sprintf("❌ 无法连接 %s: %v", msg.host, msg.err))
+			return m, nil
+		}
+		m.sshConnected = msg.host
+		m.sshCwd = msg.cwd
+		m.messages = append(m.messages, fmt.Sprintf("✓ 已连接到: %s", msg.host))
+		return m, nil
+
+	case ptyExitedMsg:
+		if msg.err != nil {
+			m.messages = append(m.messages, fmt.Sprintf("❌ shell 异常退出 %s: %v", msg.host, msg.err))
+		} else {
+			m.messages = append(m.messages, statusStyle.Render(fmt.Sprintf("  已退出 %s 的 shell", msg.host)))
+		}
+		return m, nil
+
+	case sshOutputMsg:
+		if msg.stderr {
+			m.messages = append(m.messages, stderrStyle.Render("✗ "+msg.line))
+		} else {
+			m.messages = append(m.messages, fmt.Sprintf("✓ %s", msg.line))
+		}
+		return m, nil
+
+	case sshResultMsg:
+		m.loading = false
+		m.sshRunning = false
+		if msg.cwd != "" {
+			m.sshCwd = msg.cwd
+		}
+		// 耗时和退出码
+		seconds := float64(msg.duration.Milliseconds()) / 1000.0
+		switch {
+		case msg.err != nil:
+			m.messages = append(m.messages, stderrStyle.Render(fmt.Sprintf("  - %.2f · %v", seconds, msg.err)))
+		case msg.status != 0:
+			m.messages = append(m.messages, stderrStyle.Render(fmt.Sprintf("  - %.2f · 退出码 %d", seconds, msg.status)))
+		default:
+			m.messages = append(m.messages, statusStyle.Render(fmt.Sprintf("  - %.2f · 退出码 0", seconds)))
+		}
+		return m, nil
+
 	case newMessageMsg:
 		// 从 API 收到的新消息
-		m.messages = append(m.messages, fmt.Sprintf("📨 %s", msg.text))
+		m.messages = append(m.messages, fmt.Sprintf("📨 %s%s", msg.text, sentBy(msg.sender)))
 		return m, nil
 	
 	case imageMsg:
 		// 从 API 收到的图片消息
 		m.pendingImage = msg.path
-		m.messages = append(m.messages, fmt.Sprintf("🖼️  收到图片 (%s)", msg.size))
+		m.messages = append(m.messages, fmt.Sprintf("🖼️  收到图片 (%s)%s", msg.size, sentBy(msg.sender)))
 		m.messages = append(m.messages, statusStyle.Render("  按 'o' 打开图片"))
 		return m, nil
 
+	case attachmentMsg:
+		// 从 API 收到的附件
+		m.pendingImage = msg.path
+		m.messages = append(m.messages, fmt.Sprintf("📎 收到文件 %s (%s)%s", msg.name, msg.size, sentBy(msg.sender)))
+		m.messages = append(m.messages, statusStyle.Render("  按 'o' 打开文件"))
+		return m, nil
+
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
@@ -768,9 +875,16 @@ func (m model) View() string {
 			Bold(true).
 			Render("选择 SSH 主机")
 		
-		// 主机列表
+		// 主机列表：别名对齐，后面是实际连接的 user@hostname:port
+		aliasWidth := 0
+		for _, host := range m.sshHosts {
+			if w := lipgloss.Width(host.Alias); w > aliasWidth {
+				aliasWidth = w
+			}
+		}
 		var items []string
-		for i, host := range m.sshHosts {
+		for i, h := range m.sshHosts {
+			host := fmt.Sprintf("%-*s  %s", aliasWidth, h.Alias, h.summary())
 			if i == m.sshSelected {
 				// 选中项 - 绿色背景 + 黑色文字 + 箭头
 				item := lipgloss.NewStyle().
@@ -851,13 +965,26 @@ func (m model) View() string {
 		for i := 0; i < m.loadingDots; i++ {
 			dots += "."
 		}
-		loadingText = statusStyle.Render(fmt.Sprintf("  发送中%s", dots)) + "\n"
+		action := "发送中"
+		if m.sshRunning {
+			action = "运行中 (Ctrl+C 中断)"
+		}
+		loadingText = statusStyle.Render(fmt.Sprintf("  %s%s", action, dots)) + "\n"
+
+		// 已收到的部分回复
+		if m.partial != "" {
+			partialText := ""
+			for _, line := range strings.Split(m.partial, "\n") {
+				partialText += messageStyle.Render(fmt.Sprintf("✓ %s", line)) + "\n"
+			}
+			loadingText = partialText + loadingText
+		}
 	}
 
 	// 输入框（固定在底部，宽度占满窗口）
 	prompt := ">"
 	if m.sshConnected != "" {
-		prompt = fmt.Sprintf("[%s]>", m.sshConnected)
+		prompt = fmt.Sprintf("[%s:%s]>", m.sshConnected, m.sshCwd)
 	}
 	inputContent := fmt.Sprintf("%s %s█", prompt, m.input)
 	
@@ -877,9 +1004,9 @@ func (m model) View() string {
 	// 帮助
 	helpText := "Ctrl+C 两次退出 | ESC 退出"
 	if m.pendingImage != "" {
-		helpText = "按 'o' 打开图片 | " + helpText
+		helpText = "按 'o' 打开 | " + helpText
 	} else if m.sshConnected != "" {
-		helpText = "/exit 断开SSH | " + helpText
+		helpText = "/shell 全屏 shell | /exit 断开SSH | " + helpText
 	}
 	help := statusStyle.Render("  " + helpText)
 
@@ -893,30 +1020,64 @@ func (m model) View() string {
 }
 
 // HTTP 服务器
+// 当前运行的 HTTP 服务器（headless 模式下用于优雅退出）
+var httpServer *http.Server
+
+// 所有路由，外面依次是认证和限流
+func serverHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mcp", mcpHandler)
+	mux.HandleFunc("/message", messageHandler)
+	mux.HandleFunc("/messages", messagesHandler)
+	mux.HandleFunc("/health", healthHandler)
+	mux.HandleFunc("/ws", wsHandler)
+	mux.HandleFunc("/api/message", apiHandler)
+	mux.HandleFunc("/api/images/", imageAPIHandler)
+	mux.HandleFunc("/api/attachments/", attachmentAPIHandler)
+	return authHandler(limitHandler(mux))
+}
+
 func startServer(port int) (chan bool, error) {
 	ready := make(chan bool)
 	
 	// 加载或生成 token
 	authToken = loadOrGenerateToken()
+
+	if err := setupServerTLS(); err != nil {
+		return nil, err
+	}
 	
 	// 先检查端口是否可用
-	addr := fmt.Sprintf(":%d", port)
+	addr := net.JoinHostPort(bindAddress, strconv.Itoa(port))
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, fmt.Errorf("端口 %d 已被占用或无法使用", port)
 	}
 	
-	http.HandleFunc("/mcp", mcpHandler)
-	http.HandleFunc("/message", messageHandler)
-	http.HandleFunc("/messages", messagesHandler)
-	http.HandleFunc("/health", healthHandler)
-	http.HandleFunc("/api/message", authMiddleware(apiHandler))
+	httpServer = &http.Server{Handler: serverHandler(), TLSConfig: serverTLS}
+	// 关闭时结束所有 SSE 流，否则 Shutdown 会一直等待
+	httpServer.RegisterOnShutdown(closeAllSessions)
+	httpServer.RegisterOnShutdown(closeAllWebSockets)
 	
 	go func() {
-		log.Printf("MCP Server listening on http://localhost%s\n", addr)
-		log.Printf("API Endpoint: POST /api/message (需要 token 认证)\n")
+		scheme := "http"
+		if serverTLS != nil {
+			scheme = "https"
+		}
+		log.Printf("MCP Server listening on %s://%s\n", scheme, listener.Addr())
+		log.Printf("API Endpoint: POST /api/message\n")
+		log.Printf("API Endpoint: GET /api/images/{id}[/raw]\n")
+		log.Printf("API Endpoint: GET /api/attachments/{id}[/raw]\n")
+		log.Printf("API Endpoint: GET /ws (WebSocket)\n")
+		log.Printf("🔒 所有端点需要 token 认证 (公开: %s)\n", publicPathList())
 		ready <- true
-		if err := http.Serve(listener, nil); err != nil {
+		var err error
+		if serverTLS != nil {
+			err = httpServer.ServeTLS(listener, "", "")
+		} else {
+			err = httpServer.Serve(listener)
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatal(err)
 		}
 	}()
@@ -925,23 +1086,85 @@ func startServer(port int) (chan bool, error) {
 }
 
 func mcpHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+	switch r.Method {
+	case http.MethodPost:
+	case http.MethodGet:
+		mcpStreamHandler(w, r)
+		return
+	case http.MethodDelete:
+		mcpDeleteHandler(w, r)
+		return
+	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var req JSONRPCRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendError(w, req.ID, -32700, "Parse error")
+		if isBodyTooLarge(err) {
+			writeBodyTooLarge(w, r)
+			return
+		}
+		writeRPC(w, newRPCError(req.ID, -32700, "Parse error"))
+		return
+	}
+
+	// initialize 创建新会话；其它请求如果带了会话 ID 必须是有效的
+	var session *mcpSession
+	if req.Method == "initialize" {
+		session = newSession()
+		w.Header().Set("Mcp-Session-Id", session.id)
+	} else if id := r.Header.Get("Mcp-Session-Id"); id != "" {
+		if session = getSession(id); session == nil {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	// 客户端接受 SSE 时，工具调用的响应以事件流返回，进度通知写在同一个流里
+	if req.Method == "tools/call" && acceptsEventStream(r) {
+		writeSSEHeaders(w)
+		stream := &postStream{w: w}
+		resp := handleRPC(withNotifier(r.Context(), stream), req)
+		data, _ := json.Marshal(resp)
+		stream.send(data)
 		return
 	}
 
+	// 否则进度通知走会话的 GET 流
+	ctx := r.Context()
+	if session != nil {
+		ctx = withNotifier(ctx, session)
+	}
+
+	resp := handleRPC(ctx, req)
+	if resp == nil {
+		// 通知不需要响应
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	writeRPC(w, resp)
+}
+
+// 处理单个 JSON-RPC 请求（HTTP 和 stdio 传输共用）
+// 通知消息没有 id，返回 nil
+func handleRPC(ctx context.Context, req JSONRPCRequest) *JSONRPCResponse {
+	if req.ID == nil && strings.HasPrefix(req.Method, "notifications/") {
+		return nil
+	}
+	if err := requireScope(ctx, rpcScope(req)); err != nil {
+		return newRPCError(req.ID, -32003, fmt.Sprintf("Forbidden: %v", err))
+	}
+
 	switch req.Method {
 	case "initialize":
-		sendResponse(w, req.ID, map[string]interface{}{
+		return newRPCResult(req.ID, map[string]interface{}{
 			"protocolVersion": PROTOCOL_VERSION,
 			"capabilities": map[string]interface{}{
-				"tools": map[string]bool{"listChanged": true},
+				"tools":     map[string]bool{"listChanged": true},
+				"resources": map[string]bool{"subscribe": true, "listChanged": true},
+				"prompts":   map[string]bool{"listChanged": false},
+				"logging":   map[string]interface{}{},
 			},
 			"serverInfo": map[string]string{
 				"name":    "cicy-go-server",
@@ -949,20 +1172,46 @@ func mcpHandler(w http.ResponseWriter, r *http.Request) {
 			},
 		})
 
+	case "ping", "logging/setLevel":
+		return newRPCResult(req.ID, map[string]interface{}{})
+
 	case "tools/list":
-		sendResponse(w, req.ID, map[string]interface{}{
+		return newRPCResult(req.ID, map[string]interface{}{
 			"tools": tools,
 		})
 
 	case "tools/call":
-		handleToolCall(w, req)
+		return handleToolCall(ctx, req)
+
+	case "resources/list":
+		return handleResourcesList(req)
+
+	case "resources/read":
+		return handleResourcesRead(req)
+
+	case "resources/templates/list":
+		return newRPCResult(req.ID, map[string]interface{}{
+			"resourceTemplates": resourceTemplates,
+		})
+
+	case "resources/subscribe":
+		return handleResourcesSubscribe(ctx, req, true)
+
+	case "resources/unsubscribe":
+		return handleResourcesSubscribe(ctx, req, false)
+
+	case "prompts/list":
+		return handlePromptsList(req)
+
+	case "prompts/get":
+		return handlePromptsGet(req)
 
 	default:
-		sendError(w, req.ID, -32601, fmt.Sprintf("Method not found: %s", req.Method))
+		return newRPCError(req.ID, -32601, fmt.Sprintf("Method not found: %s", req.Method))
 	}
 }
 
-func handleToolCall(w http.ResponseWriter, req JSONRPCRequest) {
+func handleToolCall(ctx context.Context, req JSONRPCRequest) *JSONRPCResponse {
 	name, _ := req.Params["name"].(string)
 	args, _ := req.Params["arguments"].(map[string]interface{})
 
@@ -970,22 +1219,49 @@ func handleToolCall(w http.ResponseWriter, req JSONRPCRequest) {
 	case "send_message":
 		message, _ := args["message"].(string)
 		if message == "" {
-			sendError(w, req.ID, -32602, "Invalid params: message required")
-			return
+			return newRPCError(req.ID, -32602, "Invalid params: message required")
 		}
 
-		msgMutex.Lock()
-		msg := Message{
+		if _, err := appendMessage(ctx, Message{
 			Type:      "text",
 			Text:      message,
 			Timestamp: time.Now(),
-			ID:        len(messages) + 1,
+		}); err != nil {
+			return newRPCError(req.ID, -32603, fmt.Sprintf("Internal error: %v", err))
+		}
+
+		// 调用方提供 progressToken 时，流式回复的每一段作为进度通知发送
+		var progressToken interface{}
+		if meta, ok := req.Params["_meta"].(map[string]interface{}); ok {
+			progressToken = meta["progressToken"]
 		}
-		messages = append(messages, msg)
-		msgMutex.Unlock()
 
-		reply := getRandomResponse()
-		sendResponse(w, req.ID, map[string]interface{}{
+		var reply string
+		var err error
+		if n := notifierFromContext(ctx); progressToken != nil && n != nil {
+			progress := 0
+			reply, err = respondStream(ctx, responder, message, func(chunk string) {
+				progress += len([]rune(chunk))
+				n.notify("notifications/progress", map[string]interface{}{
+					"progressToken": progressToken,
+					"progress":      progress,
+					"message":       chunk,
+				})
+			})
+		} else {
+			reply, err = responder.Respond(ctx, message)
+		}
+		if err != nil {
+			log.Printf("❌ 生成回复失败: %v", err)
+			return newRPCResult(req.ID, map[string]interface{}{
+				"content": []map[string]string{
+					{"type": "text", "text": fmt.Sprintf("Responder error: %v", err)},
+				},
+				"isError": true,
+			})
+		}
+
+		return newRPCResult(req.ID, map[string]interface{}{
 			"content": []map[string]string{
 				{"type": "text", "text": reply},
 			},
@@ -993,25 +1269,42 @@ func handleToolCall(w http.ResponseWriter, req JSONRPCRequest) {
 		})
 
 	case "get_messages":
-		msgMutex.RLock()
-		allMessages := append([]Message{}, messages...)
-		msgMutex.RUnlock()
+		q, err := queryParamsFromArgs(args).build(defaultPageSize)
+		if err != nil {
+			return newRPCError(req.ID, -32602, fmt.Sprintf("Invalid params: %v", err))
+		}
 
-		data, _ := json.MarshalIndent(allMessages, "", "  ")
-		sendResponse(w, req.ID, map[string]interface{}{
-			"content": []map[string]string{
-				{"type": "text", "text": string(data)},
-			},
+		page, nextCursor, err := findPage(q)
+		if err != nil {
+			return newRPCError(req.ID, -32603, fmt.Sprintf("Internal error: %v", err))
+		}
+
+		data, _ := json.Marshal(page)
+		content := []map[string]string{
+			{"type": "text", "text": string(data)},
+		}
+		result := map[string]interface{}{
+			"content": content,
 			"isError": false,
-		})
+		}
+		if nextCursor != "" {
+			result["content"] = append(content, map[string]string{
+				"type": "text",
+				"text": fmt.Sprintf("More messages available, call again with cursor: %s", nextCursor),
+			})
+			result["nextCursor"] = nextCursor
+		}
+		return newRPCResult(req.ID, result)
 
 	case "clear_messages":
-		msgMutex.Lock()
-		messages = []Message{}
-		images = []Image{}
-		msgMutex.Unlock()
+		cleared, err := store.Clear()
+		if err != nil {
+			return newRPCError(req.ID, -32603, fmt.Sprintf("Internal error: %v", err))
+		}
+		removeUnusedBlobs(cleared)
+		broadcastNotification("notifications/resources/list_changed", nil)
 
-		sendResponse(w, req.ID, map[string]interface{}{
+		return newRPCResult(req.ID, map[string]interface{}{
 			"content": []map[string]string{
 				{"type": "text", "text": "All messages cleared"},
 			},
@@ -1019,7 +1312,7 @@ func handleToolCall(w http.ResponseWriter, req JSONRPCRequest) {
 		})
 
 	default:
-		sendError(w, req.ID, -32601, fmt.Sprintf("Tool not found: %s", name))
+		return newRPCError(req.ID, -32601, fmt.Sprintf("Tool not found: %s", name))
 	}
 }
 
@@ -1031,6 +1324,10 @@ func messageHandler(w http.ResponseWriter, r *http.Request) {
 
 	var body map[string]interface{}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		if isBodyTooLarge(err) {
+			writeBodyTooLarge(w, r)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -1044,86 +1341,201 @@ func messageHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	msgMutex.Lock()
-	msg := Message{
+	if _, err := appendMessage(r.Context(), Message{
 		Type:      "text",
 		Text:      message,
 		Timestamp: time.Now(),
-		ID:        len(messages) + 1,
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// 流式变体：Accept: text/event-stream 或 ?stream=1
+	if acceptsEventStream(r) || r.URL.Query().Get("stream") == "1" {
+		streamReply(w, r, message)
+		return
+	}
+
+	reply, err := responder.Respond(r.Context(), message)
+	if err != nil {
+		log.Printf("❌ 生成回复失败: %v", err)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
 	}
-	messages = append(messages, msg)
-	msgMutex.Unlock()
 
-	reply := getRandomResponse()
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
 		"message": reply,
 	})
 }
 
+// 以 SSE 返回回复：每段一个 chunk 事件，最后是 done 或 error 事件
+func streamReply(w http.ResponseWriter, r *http.Request, message string) {
+	writeSSEHeaders(w)
+	w.WriteHeader(http.StatusOK)
+
+	reply, err := respondStream(r.Context(), responder, message, func(chunk string) {
+		data, _ := json.Marshal(map[string]string{"text": chunk})
+		writeSSEEvent(w, "chunk", data)
+	})
+	if err != nil {
+		log.Printf("❌ 生成回复失败: %v", err)
+		data, _ := json.Marshal(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		writeSSEEvent(w, "error", data)
+		return
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"success": true,
+		"message": reply,
+	})
+	writeSSEEvent(w, "done", data)
+}
+
 func messagesHandler(w http.ResponseWriter, r *http.Request) {
-	msgMutex.RLock()
-	defer msgMutex.RUnlock()
+	params, err := queryParamsFromURL(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// 未指定 limit 时最多返回 maxPageSize 条，不会一次读出整个存储
+	q, err := params.build(maxPageSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, nextCursor, err := findPage(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(messages)
+	if nextCursor != "" {
+		w.Header().Set("X-Next-Cursor", nextCursor)
+	}
+
+	// 分页请求返回 {messages, nextCursor}；不带 limit / cursor 的旧请求保持数组格式，
+	// 超过一页时下一页游标只在 X-Next-Cursor 响应头中
+	if params.limit > 0 || params.cursor != "" {
+		result := map[string]interface{}{"messages": page}
+		if nextCursor != "" {
+			result["nextCursor"] = nextCursor
+		}
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+	json.NewEncoder(w).Encode(page)
 }
 
 func healthHandler(w http.ResponseWriter, r *http.Request) {
-	msgMutex.RLock()
-	msgCount := len(messages)
-	imgCount := len(images)
-	msgMutex.RUnlock()
+	allMessages, err := store.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	msgCount, imgCount, fileCount := 0, 0, 0
+	for _, msg := range allMessages {
+		switch msg.Type {
+		case "image":
+			imgCount++
+		case "attachment":
+			fileCount++
+		default:
+			msgCount++
+		}
+	}
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":   "ok",
-		"protocol": "mcp",
-		"version":  PROTOCOL_VERSION,
-		"messages": msgCount,
-		"images":   imgCount,
+		"status":      "ok",
+		"protocol":    "mcp",
+		"version":     PROTOCOL_VERSION,
+		"messages":    msgCount,
+		"images":      imgCount,
+		"attachments": fileCount,
 	})
 }
 
-func sendResponse(w http.ResponseWriter, id interface{}, result interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(JSONRPCResponse{
+func newRPCResult(id interface{}, result interface{}) *JSONRPCResponse {
+	return &JSONRPCResponse{
 		JSONRPC: "2.0",
 		ID:      id,
 		Result:  result,
-	})
+	}
 }
 
-func sendError(w http.ResponseWriter, id interface{}, code int, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(JSONRPCResponse{
+func newRPCError(id interface{}, code int, message string) *JSONRPCResponse {
+	return &JSONRPCResponse{
 		JSONRPC: "2.0",
 		ID:      id,
 		Error: &RPCError{
 			Code:    code,
 			Message: message,
 		},
-	})
+	}
+}
+
+func writeRPC(w http.ResponseWriter, resp *JSONRPCResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
 }
 
-// 发送消息到本地服务器
-func sendMessageToServer(message string, port int) string {
-	url := fmt.Sprintf("http://localhost:%d/message", port)
+// 发送消息到本地服务器，流式读取回复，每收到一段调用 onChunk
+func sendMessageToServer(message, serverURL, token string, onChunk func(chunk string)) string {
+	url := serverURL + "/message?stream=1"
 	body := map[string]string{"message": message}
 	data, _ := json.Marshal(body)
 
-	resp, err := http.Post(url, "application/json", strings.NewReader(string(data)))
+	req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(string(data)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	setAuthHeader(req, token)
+
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return "错误: 无法连接到服务器"
 	}
 	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return "错误: token 无效"
+	case resp.StatusCode == http.StatusTooManyRequests && retryAfter(resp) > 0:
+		return fmt.Sprintf("错误: 请求过于频繁，%d 秒后重试", retryAfterSeconds(retryAfter(resp)))
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		// 消息没有保存，不能显示默认回复
+		return "错误: " + httpStatusError(resp).Error()
+	}
 
-	var result map[string]interface{}
-	json.NewDecoder(resp.Body).Decode(&result)
+	reply := "收到"
+	readSSE(resp.Body, func(event, data string) error {
+		var result map[string]interface{}
+		json.Unmarshal([]byte(data), &result)
 
-	if msg, ok := result["message"].(string); ok {
-		return msg
-	}
-	return "收到"
+		switch event {
+		case "chunk":
+			if text, ok := result["text"].(string); ok {
+				onChunk(text)
+			}
+		case "done":
+			if msg, ok := result["message"].(string); ok {
+				reply = msg
+			}
+		case "error":
+			if errMsg, ok := result["error"].(string); ok {
+				reply = "错误: " + errMsg
+			}
+		}
+		return nil
+	})
+	return reply
 }
 
 // 打开图片文件
@@ -1134,67 +1546,160 @@ func openImage(path string) {
 	}
 }
 
-// 读取 SSH 配置文件中的主机名
-func getSSHHosts() []string {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return nil
-	}
-
-	configPath := filepath.Join(homeDir, ".ssh", "config")
-	data, err := os.ReadFile(configPath)
-	if err != nil {
-		return nil
-	}
-
-	var hosts []string
-	lines := strings.Split(string(data), "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if strings.HasPrefix(line, "Host ") {
-			host := strings.TrimPrefix(line, "Host ")
-			host = strings.TrimSpace(host)
-			// 跳过通配符
-			if !strings.Contains(host, "*") && host != "" {
-				hosts = append(hosts, host)
-			}
-		}
-	}
-
-	return hosts
-}
-
-// 执行 SSH 命令
-func executeSSHCommand(host, command string) string {
-	cmd := exec.Command("ssh", host, command)
-	output, err := cmd.CombinedOutput()
+func main() {
+	// 配置：默认值 → 配置文件 → CICY_* 环境变量，命令行参数的默认值取自这里
+	configPath, explicit := configPathFromArgs(os.Args[1:])
+	cfg, err := loadConfig(configPath, explicit)
 	if err != nil {
-		return fmt.Sprintf("错误: %v", err)
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		os.Exit(2)
 	}
-	return strings.TrimSpace(string(output))
-}
+	appConfig = cfg
 
-func main() {
 	// 命令行参数
 	helpFlag := flag.Bool("help", false, "显示帮助信息")
 	versionFlag := flag.Bool("version", false, "显示版本号")
-	portFlag := flag.Int("port", 13001, "服务器端口")
+	flag.String("config", configPath, "配置文件 (YAML)")
+	portFlag := flag.Int("port", cfg.intValue("port"), "服务器端口")
+	bindFlag := flag.String("bind", cfg.get("bind"), "监听地址 (默认所有网卡，127.0.0.1 只允许本机访问)")
+	publicPathsFlag := flag.String("public-paths", cfg.get("public-paths"), "不需要 token 的路径，逗号分隔")
+	flag.String("tls-cert", cfg.get("tls-cert"), "TLS 证书 (PEM)")
+	flag.String("tls-key", cfg.get("tls-key"), "TLS 私钥 (PEM)")
+	flag.Bool("tls-self-signed", cfg.boolValue("tls-self-signed"), "在数据目录生成并使用自签名证书")
+	flag.String("tls-client-ca", cfg.get("tls-client-ca"), "验证客户端证书的 CA (双向 TLS)")
+	stdioFlag := flag.Bool("stdio", false, "通过 stdin/stdout 提供 MCP 服务（不启动 TUI）")
+	flag.String("token-file", cfg.get("token-file"), "API token 文件")
+	flag.String("tokens-file", cfg.get("tokens-file"), "客户端 token 文件 (cicy-go token add 管理)")
+	storeFlag := flag.String("store", cfg.get("store"), "消息存储: memory 或 bolt")
+	storePathFlag := flag.String("store-path", cfg.get("store-path"), "bolt 存储文件路径")
+	responderFlag := flag.String("responder", cfg.get("responder"), "回复生成器: echo, random, rules, openai")
+	rulesFlag := flag.String("rules", cfg.get("rules"), "rules 回复使用的规则文件 (YAML/JSON)")
+	openaiURLFlag := flag.String("openai-url", cfg.get("openai-url"), "OpenAI 兼容接口地址")
+	openaiModelFlag := flag.String("openai-model", cfg.get("openai-model"), "OpenAI 兼容接口的模型名")
+	flag.String("openai-key", "", "OpenAI 兼容接口的 API key (默认读取 OPENAI_API_KEY)")
+	systemPromptFlag := flag.String("system-prompt", cfg.get("system-prompt"), "openai 回复使用的 system prompt")
+	promptsFlag := flag.String("prompts", cfg.get("prompts"), "MCP prompt 模板目录")
+	maxImageFlag := flag.Int("max-image-size", cfg.intValue("max-image-size"), "图片大小上限 (MB)")
+	imageTimeoutFlag := flag.Duration("image-timeout", cfg.durationValue("image-timeout"), "下载图片和附件的超时时间")
+	flag.Duration("ssh-timeout", cfg.durationValue("ssh-timeout"), "SSH 模式下命令的超时时间 (0 表示不限制)")
+	maxAttachmentFlag := flag.Int("max-attachment-size", cfg.intValue("max-attachment-size"), "附件大小上限 (MB)")
+	rateLimitFlag := flag.Float64("rate-limit", cfg.floatValue("rate-limit"), "每个客户端每秒的请求数 (0 表示不限流)")
+	rateBurstFlag := flag.Int("rate-burst", cfg.intValue("rate-burst"), "限流的突发请求数")
+	maxBodyFlag := flag.Int("max-body-size", cfg.intValue("max-body-size"), "请求体大小上限 (KB，/api/message 除外)")
+	maxUploadFlag := flag.Int("max-upload-size", cfg.intValue("max-upload-size"), "/api/message 请求体大小上限 (MB)")
+	maxMessagesFlag := flag.Int("max-messages", cfg.intValue("max-messages"), "最多保存的消息数 (0 表示不限制)")
+	maxStoreFlag := flag.Int("max-store-size", cfg.intValue("max-store-size"), "消息总大小上限 (MB，0 表示不限制)")
+	dataDirFlag := flag.String("data-dir", cfg.get("data-dir"), "附件数据目录")
+	headlessFlag := flag.Bool("headless", false, "只运行服务器，不启动 TUI")
+	logFileFlag := flag.String("log-file", cfg.get("log-file"), "headless 模式的日志文件 (默认: stderr)")
+	pidFileFlag := flag.String("pidfile", cfg.get("pidfile"), "headless 模式的 pid 文件 (空字符串表示不写)")
 	flag.BoolVar(helpFlag, "h", false, "显示帮助信息")
 	flag.BoolVar(versionFlag, "v", false, "显示版本号")
-	flag.IntVar(portFlag, "p", 13001, "服务器端口")
-	flag.Parse()
+	flag.IntVar(portFlag, "p", cfg.intValue("port"), "服务器端口")
+
+	// 子命令：serve 只运行服务器，其他客户端命令见 cli.go；不带子命令时同时运行 TUI 和服务器
+	args := os.Args[1:]
+	command := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	switch command {
+	case "", "serve":
+	case "tui":
+		os.Exit(runTUIClient(args))
+	case "send":
+		os.Exit(runSend(args))
+	case "tail":
+		os.Exit(runTail(args))
+	case "token":
+		os.Exit(runToken(args))
+	case "config":
+		if len(args) == 0 || args[0] != "print" {
+			fmt.Fprintf(os.Stderr, "用法: cicy-go config print [选项]\n")
+			os.Exit(2)
+		}
+		args = args[1:]
+	case "help":
+		*helpFlag = true
+	default:
+		fmt.Fprintf(os.Stderr, "未知命令: %s (运行 cicy-go --help 查看用法)\n", command)
+		os.Exit(2)
+	}
+	flag.CommandLine.Parse(args)
+	cfg.applyFlags(flag.CommandLine)
+	cfg.deriveURL()
+	if err := setupClientTLS(); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		os.Exit(2)
+	}
+	if command == "config" {
+		cfg.print(os.Stdout)
+		return
+	}
+	if command == "serve" {
+		*headlessFlag = true
+	}
 
 	if *helpFlag {
 		fmt.Printf(`
 CICY - MCP Message Communication System v%s (Go Edition)
 
 用法 (Usage):
-  cicy-go [选项]
+  cicy-go [选项]                  同时运行 TUI 和服务器
+  cicy-go serve [选项]            只运行服务器 (systemd / Docker / CI)
+  cicy-go tui [--url URL]         TUI 作为客户端连接到服务器
+  cicy-go send "文本"             发送消息 (- 读取 stdin)
+  cicy-go send --image a.png      发送图片，--file 发送附件
+  cicy-go tail [--json]           持续输出新消息
+  cicy-go token show|rotate       显示 / 重新生成 API token
+  cicy-go token add NAME [--scopes S] [--cert-cn CN] 添加客户端 token (list 列出，revoke NAME 撤销)
+  cicy-go config print            显示生效的配置及来源
+
+  客户端命令的服务器地址取自 --url 或 CICY_URL (默认 localhost 上的 -p / --port)，
+  token 取自 --token、CICY_TOKEN 或 ~/data/cicy-server.txt，
+  HTTPS 服务器用 --tls-ca 固定 CA，--tls-client-cert / --tls-client-key 使用客户端证书
 
 选项 (Options):
   -h, --help       显示帮助信息
   -v, --version    显示版本号
   -p, --port PORT  指定端口 (默认: 13001)
+      --config FILE 配置文件 (默认: ~/.config/cicy/config.yaml)
+      --bind ADDR      监听地址 (默认所有网卡，127.0.0.1 只允许本机访问)
+      --public-paths P 不需要 token 的路径，逗号分隔 (默认: /health)
+      --token-file FILE   API token 文件 (默认: ~/data/cicy-server.txt)
+      --tokens-file FILE  客户端 token 和权限 (默认: ~/data/cicy-tokens.json)
+      --tls-cert FILE     TLS 证书，与 --tls-key 一起使用 (HTTPS)
+      --tls-key FILE      TLS 私钥
+      --tls-self-signed   首次运行时在 <data-dir>/tls 生成自签名证书并使用
+      --tls-client-ca FILE 接受该 CA 签发的客户端证书 (双向 TLS，可代替 token)
+      --stdio      以 MCP stdio 模式运行 (JSON-RPC over stdin/stdout)
+      --store TYPE 消息存储: memory (默认) 或 bolt (持久化)
+      --store-path 持久化存储文件 (默认: ~/data/cicy.db)
+      --responder  回复生成器: echo, random (默认), rules, openai
+      --rules FILE rules 回复的规则文件 (YAML/JSON，正则 → 回复模板)
+      --openai-url URL    OpenAI 兼容接口地址 (默认: https://api.openai.com/v1)
+      --openai-model NAME 模型名
+      --openai-key KEY    API key (默认读取 OPENAI_API_KEY)
+      --system-prompt TXT system prompt
+      --prompts DIR       MCP prompt 模板目录 (默认: ~/.config/cicy/prompts)
+      --max-image-size MB 图片大小上限 (默认: 20)
+      --image-timeout DUR 下载图片和附件的超时时间 (默认: 30s)
+      --ssh-timeout DUR   SSH 模式下命令的超时时间，超时后中断命令 (默认: 10m，0 不限制)
+      --max-attachment-size MB 附件大小上限 (默认: 50)
+      --rate-limit N      每个客户端 (token 或 IP) 每秒的请求数，超出返回 429 (默认: 10，0 不限流)
+      --rate-burst N      允许的突发请求数 (默认: 40)
+      --max-body-size KB  请求体大小上限 (默认: 1024)
+      --max-upload-size MB /api/message 请求体大小上限 (默认: 100)
+      --max-messages N    最多保存的消息数，超出时删除最旧的 (默认: 0 不限制)
+      --max-store-size MB 消息总大小上限，超出时删除最旧的 (默认: 0 不限制)
+      --data-dir DIR      附件数据目录，按 SHA-256 保存 (默认: ~/data/cicy)
+      --headless          只运行服务器，不启动 TUI (同 serve)；SIGTERM 时优雅退出
+      --log-file FILE     headless 模式的日志文件 (默认: stderr)
+      --pidfile FILE      headless 模式的 pid 文件 (默认: ~/data/cicy-go.pid)
+
+配置 (Config):
+  默认值 → ~/.config/cicy/config.yaml → CICY_* 环境变量 → 命令行参数
+  配置文件的键与参数同名 (port, store, token-file, url ...)，环境变量如 CICY_STORE_PATH
 
 功能 (Features):
   • 单进程运行 TUI 客户端 + MCP 服务器
@@ -1216,25 +1721,125 @@ CICY - MCP Message Communication System v%s (Go Edition)
 		os.Exit(0)
 	}
 
-	// 启动 HTTP 服务器
-	serverPort := *portFlag
-	ready, err := startServer(serverPort)
+	// 端口上已有 cicy 服务器（例如 headless 守护进程）时 TUI 作为客户端连接，
+	// 不打开存储（bolt 文件由服务器进程持有）
+	attached := !*stdioFlag && !*headlessFlag && isCicyServer(localURL(*portFlag))
+
+	// 打开消息存储
+	if !attached {
+		st, err := openStore(*storeFlag, *storePathFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ 无法打开存储: %v\n", err)
+			os.Exit(1)
+		}
+		store = st
+		defer store.Close()
+	}
+
+	// 回复生成器
+	resp, err := newResponder(responderConfig{
+		kind:        *responderFlag,
+		rulesFile:   *rulesFlag,
+		openaiURL:   *openaiURLFlag,
+		openaiModel: *openaiModelFlag,
+		openaiKey:   cfg.get("openai-key"), // 密钥不作为参数默认值，避免出现在用法输出中
+		systemMsg:   *systemPromptFlag,
+	})
 	if err != nil {
-		// 端口被占用，只显示警告，不启动服务器
-		fmt.Printf("⚠️  警告: 端口 %d 已被占用，服务器未启动\n", serverPort)
-		fmt.Printf("提示: TUI 将继续运行，但无法发送消息\n\n")
-		time.Sleep(2 * time.Second) // 让用户看到警告
-		serverPort = 0 // 标记服务器未启动
-	} else {
-		<-ready // 等待服务器就绪
+		fmt.Fprintf(os.Stderr, "❌ 无法创建回复生成器: %v\n", err)
+		os.Exit(1)
+	}
+	responder = resp
+	promptsDir = *promptsFlag
+	maxImageSize = int64(*maxImageFlag) * 1024 * 1024
+	imageFetchTimeout = *imageTimeoutFlag
+	maxAttachmentSize = int64(*maxAttachmentFlag) * 1024 * 1024
+	dataDir = *dataDirFlag
+	rateLimit = *rateLimitFlag
+	rateBurst = *rateBurstFlag
+	maxBodySize = int64(*maxBodyFlag) * 1024
+	maxUploadSize = int64(*maxUploadFlag) * 1024 * 1024
+	maxMessages = *maxMessagesFlag
+	maxStoreSize = int64(*maxStoreFlag) * 1024 * 1024
+	bindAddress = *bindFlag
+	publicPaths = parsePublicPaths(*publicPathsFlag)
+
+	// stdio 模式：stdout 只输出 JSON-RPC，日志写到 stderr
+	if *stdioFlag {
+		runStdio(*portFlag)
+		return
+	}
+
+	if *headlessFlag {
+		runHeadless(*portFlag, *logFileFlag, *pidFileFlag)
+		return
 	}
 
-	// 启动 TUI
-	p := tea.NewProgram(initialModel(serverPort), tea.WithAltScreen())
+	// 启动 HTTP 服务器
+	serverURL := localURL(*portFlag)
+	if !attached {
+		ready, err := startServer(*portFlag)
+		if err != nil {
+			// 端口被占用或证书无效，只显示警告，不启动服务器
+			fmt.Printf("⚠️  警告: %v，服务器未启动\n", err)
+			fmt.Printf("提示: TUI 将继续运行，但无法发送消息\n\n")
+			time.Sleep(2 * time.Second) // 让用户看到警告
+			serverURL = ""              // 标记服务器未启动
+		} else {
+			<-ready // 等待服务器就绪
+		}
+	}
+
+	// 同一进程中的服务器直接使用它的 token
+	token := authToken
+	if attached {
+		token = resolveToken("")
+	}
+	runTUI(serverURL, attached, token)
+}
+
+// 启动 TUI；attached 表示连接到其他进程中的服务器
+func runTUI(serverURL string, attached bool, token string) {
+	sshCommandTimeout = appConfig.durationValue("ssh-timeout")
+	p := tea.NewProgram(initialModel(serverURL, token, attached), tea.WithAltScreen())
 	tuiProgram = p // 保存全局引用
+	if attached {
+		go attachToServer(serverURL, token, p)
+	}
 	
-	if _, err := p.Run(); err != nil {
+	_, err := p.Run()
+	sshDisconnectAll()
+	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
 }
+
+// 默认的持久化存储路径
+func defaultStorePath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "cicy.db"
+	}
+	return filepath.Join(homeDir, "data", "cicy.db")
+}
+
+// MCP stdio 模式
+func runStdio(port int) {
+	log.SetOutput(os.Stderr)
+
+	transport := newStdioTransport(os.Stdin, os.Stdout)
+	stdioPeer = transport
+
+	// HTTP 服务器仍然启动，以便 /api/message 接收消息；端口被占用不影响 stdio
+	if ready, err := startServer(port); err != nil {
+		log.Printf("⚠️  HTTP 服务器未启动: %v", err)
+	} else {
+		<-ready
+	}
+
+	if err := transport.serve(); err != nil {
+		log.Printf("❌ stdio 传输错误: %v", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MCP 提示模板
+//
+// 模板目录中每个 .md / .txt / .tmpl 文件是一个 prompt，文件名（去掉扩展名）即 prompt 名。
+// 文件开头可以有 YAML front matter 描述参数：
+//
+//	---
+//	description: Draft a reply in a given tone
+//	arguments:
+//	  - name: tone
+//	    description: Tone of the reply
+//	    required: true
+//	---
+//	Reply to "{{lastMessage}}" in a {{.tone}} tone.
+//
+// 正文是 Go text/template：{{.参数名}} 引用参数，消息存储通过以下函数访问：
+//
+//	{{messages 20}}   最近 20 条文本消息
+//	{{today}}         今天的文本消息
+//	{{lastMessage}}   最后一条文本消息
+type PromptArgument struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description,omitempty" yaml:"description"`
+	Required    bool   `json:"required,omitempty" yaml:"required"`
+}
+
+type Prompt struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty" yaml:"description"`
+	Arguments   []PromptArgument `json:"arguments,omitempty" yaml:"arguments"`
+	body        string
+}
+
+// 内置 prompt，模板目录中同名文件会覆盖
+var builtinPrompts = []Prompt{
+	{
+		Name:        "summarize_today",
+		Description: "Summarize today's messages",
+		body:        "Summarize the following messages received today. List decisions and open questions.\n\n{{today}}",
+	},
+	{
+		Name:        "draft_reply",
+		Description: "Draft a reply to the last message",
+		Arguments: []PromptArgument{
+			{Name: "context", Description: "Number of recent messages to include as context (default 10)"},
+		},
+		body: "Recent conversation:\n\n{{messages (or .context \"10\")}}\n\nDraft a reply to the last message: {{lastMessage}}",
+	},
+}
+
+// 模板目录（--prompts）
+var promptsDir string
+
+func defaultPromptsDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(homeDir, ".config", "cicy", "prompts")
+}
+
+// 每次请求时重新读取目录，修改模板不需要重启
+func loadPrompts() []Prompt {
+	byName := map[string]Prompt{}
+	for _, p := range builtinPrompts {
+		byName[p.Name] = p
+	}
+
+	if promptsDir != "" {
+		entries, err := os.ReadDir(promptsDir)
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("⚠️  无法读取 prompt 目录: %v", err)
+		}
+		for _, entry := range entries {
+			ext := filepath.Ext(entry.Name())
+			if entry.IsDir() || (ext != ".md" && ext != ".txt" && ext != ".tmpl") {
+				continue
+			}
+
+			p, err := parsePromptFile(filepath.Join(promptsDir, entry.Name()))
+			if err != nil {
+				log.Printf("⚠️  跳过 prompt %s: %v", entry.Name(), err)
+				continue
+			}
+			byName[p.Name] = p
+		}
+	}
+
+	prompts := make([]Prompt, 0, len(byName))
+	for _, p := range byName {
+		prompts = append(prompts, p)
+	}
+	sort.Slice(prompts, func(i, j int) bool {
+		return prompts[i].Name < prompts[j].Name
+	})
+	return prompts
+}
+
+func parsePromptFile(path string) (Prompt, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Prompt{}, err
+	}
+
+	content := strings.ReplaceAll(string(data), "\r\n", "\n")
+	var p Prompt
+	if strings.HasPrefix(content, "---\n") {
+		// 结束标记是单独一行的 ---，可以紧跟在开始标记之后，也可以在文件末尾
+		lines := strings.SplitAfter(content, "\n")
+		end := 0
+		for i := 1; i < len(lines); i++ {
+			if strings.TrimRight(lines[i], "\n") == "---" {
+				end = i
+				break
+			}
+		}
+		if end == 0 {
+			return Prompt{}, fmt.Errorf("front matter 没有结束标记")
+		}
+		if err := yaml.Unmarshal([]byte(strings.Join(lines[1:end], "")), &p); err != nil {
+			return Prompt{}, fmt.Errorf("解析 front matter 失败: %v", err)
+		}
+		content = strings.Join(lines[end+1:], "")
+	}
+
+	p.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	p.body = content
+
+	// 提前检查模板语法
+	if _, err := newPromptTemplate(p); err != nil {
+		return Prompt{}, err
+	}
+	return p, nil
+}
+
+// 把消息格式化为 "[时间] 文本" 每行一条
+func formatMessages(list []Message) string {
+	var lines []string
+	for _, msg := range list {
+		lines = append(lines, fmt.Sprintf("[%s] %s", msg.Timestamp.Format("2006-01-02 15:04"), msg.Text))
+	}
+	if len(lines) == 0 {
+		return "(no messages)"
+	}
+	return strings.Join(lines, "\n")
+}
+
+func textMessages(q MessageQuery) []Message {
+	q.Type = "text"
+	list, err := store.Find(q)
+	if err != nil {
+		log.Printf("⚠️  prompt 读取消息失败: %v", err)
+		return nil
+	}
+	return list
+}
+
+func lastMessages(n int) []Message {
+	list := textMessages(MessageQuery{})
+	if n >= 0 && len(list) > n {
+		list = list[len(list)-n:]
+	}
+	return list
+}
+
+var promptFuncs = template.FuncMap{
+	// 参数都是字符串，也接受数字
+	"messages": func(n interface{}) (string, error) {
+		count, err := strconv.Atoi(strings.TrimSpace(fmt.Sprint(n)))
+		if err != nil {
+			return "", fmt.Errorf("messages: invalid count %v", n)
+		}
+		return formatMessages(lastMessages(count)), nil
+	},
+	"today": func() string {
+		now := time.Now()
+		midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		return formatMessages(textMessages(MessageQuery{Since: midnight}))
+	},
+	"lastMessage": func() string {
+		if list := lastMessages(1); len(list) > 0 {
+			return list[0].Text
+		}
+		return ""
+	},
+}
+
+func newPromptTemplate(p Prompt) (*template.Template, error) {
+	return template.New(p.Name).Funcs(promptFuncs).Option("missingkey=zero").Parse(p.body)
+}
+
+func handlePromptsList(req JSONRPCRequest) *JSONRPCResponse {
+	return newRPCResult(req.ID, map[string]interface{}{
+		"prompts": loadPrompts(),
+	})
+}
+
+func handlePromptsGet(req JSONRPCRequest) *JSONRPCResponse {
+	name, _ := req.Params["name"].(string)
+	rawArgs, _ := req.Params["arguments"].(map[string]interface{})
+
+	var prompt *Prompt
+	for _, p := range loadPrompts() {
+		if p.Name == name {
+			p := p
+			prompt = &p
+			break
+		}
+	}
+	if prompt == nil {
+		return newRPCError(req.ID, -32602, fmt.Sprintf("Prompt not found: %s", name))
+	}
+
+	args := map[string]string{}
+	for k, v := range rawArgs {
+		args[k] = fmt.Sprint(v)
+	}
+	for _, arg := range prompt.Arguments {
+		if arg.Required && args[arg.Name] == "" {
+			return newRPCError(req.ID, -32602, fmt.Sprintf("Invalid params: argument %s required", arg.Name))
+		}
+	}
+
+	tmpl, err := newPromptTemplate(*prompt)
+	if err != nil {
+		return newRPCError(req.ID, -32603, fmt.Sprintf("Internal error: %v", err))
+	}
+	var text strings.Builder
+	if err := tmpl.Execute(&text, args); err != nil {
+		return newRPCError(req.ID, -32603, fmt.Sprintf("Internal error: %v", err))
+	}
+
+	return newRPCResult(req.ID, map[string]interface{}{
+		"description": prompt.Description,
+		"messages": []map[string]interface{}{
+			{
+				"role": "user",
+				"content": map[string]string{
+					"type": "text",
+					"text": strings.TrimSpace(text.String()),
+				},
+			},
+		},
+	})
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writePromptFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParsePromptFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    Prompt
+	}{
+		{
+			"front matter",
+			"---\ndescription: Reply\narguments:\n  - name: tone\n    description: Tone\n    required: true\n---\nUse a {{.tone}} tone.\n",
+			Prompt{Description: "Reply", Arguments: []PromptArgument{{Name: "tone", Description: "Tone", Required: true}}, body: "Use a {{.tone}} tone.\n"},
+		},
+		{
+			"crlf",
+			"---\r\ndescription: Windows\r\n---\r\nbody\r\n",
+			Prompt{Description: "Windows", body: "body\n"},
+		},
+		{"no front matter", "just text\n---\nmore\n", Prompt{body: "just text\n---\nmore\n"}},
+		{"empty front matter", "---\n---\nbody", Prompt{body: "body"}},
+		{"end marker at eof", "---\ndescription: only\n---", Prompt{Description: "only", body: ""}},
+		{"dashes inside yaml value", "---\ndescription: a---b\n---\nbody", Prompt{Description: "a---b", body: "body"}},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		p, err := parsePromptFile(writePromptFile(t, dir, "p.md", tt.content))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		tt.want.Name = "p"
+		if !reflect.DeepEqual(p, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, p, tt.want)
+		}
+	}
+}
+
+func TestParsePromptFileInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"unterminated", "---\ndescription: x\nbody", "没有结束标记"},
+		{"bad yaml", "---\narguments: [\n---\nbody", "解析 front matter 失败"},
+		{"bad template", "hello {{.name", "unclosed action"},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		_, err := parsePromptFile(writePromptFile(t, dir, "p.md", tt.content))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+// 目录中的模板覆盖同名的内置 prompt，其他扩展名和无效的文件被跳过
+func TestLoadPrompts(t *testing.T) {
+	newTestServer(t)
+	promptsDir = t.TempDir()
+	writePromptFile(t, promptsDir, "summarize_today.md", "---\ndescription: Custom\n---\ncustom")
+	writePromptFile(t, promptsDir, "standup.txt", "standup")
+	writePromptFile(t, promptsDir, "notes.json", "{}")
+	writePromptFile(t, promptsDir, "broken.tmpl", "{{")
+
+	var names []string
+	descriptions := map[string]string{}
+	for _, p := range loadPrompts() {
+		names = append(names, p.Name)
+		descriptions[p.Name] = p.Description
+	}
+	if want := []string{"draft_reply", "standup", "summarize_today"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %q, want %q", names, want)
+	}
+	if descriptions["summarize_today"] != "Custom" {
+		t.Errorf("summarize_today not overridden: %q", descriptions["summarize_today"])
+	}
+}
+
+func TestHandlePromptsGet(t *testing.T) {
+	newTestServer(t)
+	promptsDir = t.TempDir()
+	writePromptFile(t, promptsDir, "reply.md", "---\narguments:\n  - name: tone\n    required: true\n---\nReply to {{lastMessage}} in a {{.tone}} tone. {{.missing}}")
+	store.Append(Message{Type: "text", Text: "first"})
+	store.Append(Message{Type: "text", Text: "second"})
+
+	get := func(args string) *JSONRPCResponse {
+		var req JSONRPCRequest
+		if err := json.Unmarshal([]byte(rpcBody("prompts/get", `{"name":"reply","arguments":`+args+`}`)), &req); err != nil {
+			t.Fatal(err)
+		}
+		return handlePromptsGet(req)
+	}
+
+	resp := get(`{"tone":"friendly"}`)
+	if resp.Error != nil {
+		t.Fatalf("prompts/get: %+v", resp.Error)
+	}
+	data, _ := json.Marshal(resp.Result)
+	if want := "Reply to second in a friendly tone."; !strings.Contains(string(data), want) {
+		t.Errorf("result = %s, want %q", data, want)
+	}
+
+	if resp := get(`{}`); resp.Error == nil || resp.Error.Code != -32602 {
+		t.Errorf("missing required argument: %+v", resp.Error)
+	}
+}
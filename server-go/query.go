@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageSize = 100  // get_messages 默认每页条数
+	maxPageSize     = 1000 // 单页上限
+)
+
+// 游标对客户端不透明，内部是最后一条消息的 ID
+func encodeCursor(id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("id:" + strconv.Itoa(id)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(data), "id:") {
+		return 0, fmt.Errorf("invalid cursor")
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(string(data), "id:"))
+	if err != nil || id < 0 {
+		return 0, fmt.Errorf("invalid cursor")
+	}
+	return id, nil
+}
+
+// get_messages 和 GET /messages 共用的原始参数
+type queryParams struct {
+	afterID int
+	cursor  string
+	limit   int
+	since   string
+	until   string
+	typ     string
+	query   string
+}
+
+// 从 MCP 工具参数读取（JSON 数字是 float64）
+func queryParamsFromArgs(args map[string]interface{}) queryParams {
+	var p queryParams
+	if v, ok := args["after_id"].(float64); ok {
+		p.afterID = int(v)
+	}
+	if v, ok := args["limit"].(float64); ok {
+		p.limit = int(v)
+	}
+	p.cursor, _ = args["cursor"].(string)
+	p.since, _ = args["since"].(string)
+	p.until, _ = args["until"].(string)
+	p.typ, _ = args["type"].(string)
+	p.query, _ = args["query"].(string)
+	return p
+}
+
+// 从 URL 查询字符串读取
+func queryParamsFromURL(values url.Values) (queryParams, error) {
+	p := queryParams{
+		cursor: values.Get("cursor"),
+		since:  values.Get("since"),
+		until:  values.Get("until"),
+		typ:    values.Get("type"),
+		query:  values.Get("query"),
+	}
+	if v := values.Get("after_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return p, fmt.Errorf("invalid after_id")
+		}
+		p.afterID = id
+	}
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return p, fmt.Errorf("invalid limit")
+		}
+		p.limit = limit
+	}
+	return p, nil
+}
+
+// 校验参数并生成查询；limit 未指定时使用 defaultLimit（0 表示不限）
+func (p queryParams) build(defaultLimit int) (MessageQuery, error) {
+	q := MessageQuery{
+		AfterID: p.afterID,
+		Query:   p.query,
+		Limit:   defaultLimit,
+	}
+
+	if q.AfterID < 0 {
+		return q, fmt.Errorf("invalid after_id")
+	}
+	if p.cursor != "" {
+		id, err := decodeCursor(p.cursor)
+		if err != nil {
+			return q, err
+		}
+		q.AfterID = id
+	}
+
+	if p.limit < 0 {
+		return q, fmt.Errorf("invalid limit")
+	}
+	if p.limit > 0 {
+		q.Limit = p.limit
+	}
+	if q.Limit > maxPageSize {
+		q.Limit = maxPageSize
+	}
+
+	switch p.typ {
+	case "", "text":
+		// 默认只返回文本消息
+		q.Type = "text"
+	case "image", "attachment":
+		q.Type = p.typ
+	case "all":
+		q.Type = ""
+	default:
+		return q, fmt.Errorf("invalid type: %s (text, image, attachment, all)", p.typ)
+	}
+
+	var err error
+	if p.since != "" {
+		if q.Since, err = time.Parse(time.RFC3339, p.since); err != nil {
+			return q, fmt.Errorf("invalid since: expected RFC3339 timestamp")
+		}
+	}
+	if p.until != "" {
+		if q.Until, err = time.Parse(time.RFC3339, p.until); err != nil {
+			return q, fmt.Errorf("invalid until: expected RFC3339 timestamp")
+		}
+	}
+
+	return q, nil
+}
+
+// 查询一页消息，还有更多时返回下一页游标
+// 图片的 base64 数据不包含在列表中
+func findPage(q MessageQuery) ([]Message, string, error) {
+	limit := q.Limit
+	if limit > 0 {
+		// 多取一条用来判断是否还有下一页
+		q.Limit = limit + 1
+	}
+
+	list, err := store.Find(q)
+	if err != nil {
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+		nextCursor = encodeCursor(list[limit-1].ID)
+	}
+
+	for i := range list {
+		list[i].Data = ""
+	}
+	return list, nextCursor, nil
+}
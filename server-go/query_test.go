@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// 不带 limit 的旧请求仍然返回数组，但最多 maxPageSize 条，下一页游标在响应头中
+func TestMessagesDefaultLimit(t *testing.T) {
+	server, tokens := newTestServer(t)
+	for i := 0; i < maxPageSize+1; i++ {
+		store.Append(Message{Type: "text", Text: "hi"})
+	}
+
+	get := func(query string) (*http.Response, []byte) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", server.URL+"/messages"+query, nil)
+		setAuthHeader(req, tokens[scopeMessagesRead])
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var body json.RawMessage
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return resp, body
+	}
+
+	resp, body := get("")
+	var list []Message
+	if err := json.Unmarshal(body, &list); err != nil {
+		t.Fatalf("legacy response is not an array: %v", err)
+	}
+	if len(list) != maxPageSize {
+		t.Errorf("len = %d, want %d", len(list), maxPageSize)
+	}
+	cursor := resp.Header.Get("X-Next-Cursor")
+	if cursor == "" {
+		t.Fatal("X-Next-Cursor missing")
+	}
+
+	_, body = get("?cursor=" + cursor)
+	var page struct {
+		Messages   []Message `json:"messages"`
+		NextCursor string    `json:"nextCursor"`
+	}
+	if err := json.Unmarshal(body, &page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Messages) != 1 || page.Messages[0].ID != maxPageSize+1 || page.NextCursor != "" {
+		t.Errorf("second page = %d messages, nextCursor %q", len(page.Messages), page.NextCursor)
+	}
+}
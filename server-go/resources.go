@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MCP 资源：消息、图片和附件可以通过 cicy:// URI 读取
+const (
+	messagesURI    = "cicy://messages"
+	imagesURI      = "cicy://images"
+	attachmentsURI = "cicy://attachments"
+)
+
+var resourceTemplates = []map[string]interface{}{
+	{
+		"uriTemplate": messagesURI + "/{id}",
+		"name":        "Message",
+		"description": "A text message by ID",
+		"mimeType":    "text/plain",
+	},
+	{
+		"uriTemplate": imagesURI + "/{id}",
+		"name":        "Image",
+		"description": "An image by ID, returned as a base64 blob",
+	},
+	{
+		"uriTemplate": attachmentsURI + "/{id}",
+		"name":        "Attachment",
+		"description": "A file attachment by ID; text files are returned as text, others as a base64 blob",
+	},
+}
+
+// 资源 URI 对应的集合（messages / images / attachments）
+func collectionURI(msg Message) string {
+	switch msg.Type {
+	case "image":
+		return imagesURI
+	case "attachment":
+		return attachmentsURI
+	}
+	return messagesURI
+}
+
+func resourceURI(msg Message) string {
+	return fmt.Sprintf("%s/%d", collectionURI(msg), msg.ID)
+}
+
+func resourceInfo(msg Message) map[string]interface{} {
+	info := map[string]interface{}{
+		"uri":  resourceURI(msg),
+		"name": fmt.Sprintf("message %d", msg.ID),
+	}
+	if msg.Type == "image" || msg.Type == "attachment" {
+		info["name"] = msg.Name
+		info["mimeType"] = msg.MimeType
+		info["size"] = msg.Size
+	} else {
+		info["mimeType"] = "text/plain"
+		info["size"] = len(msg.Text)
+	}
+	return info
+}
+
+// 解析 cicy://messages/{id}、cicy://images/{id} 或 cicy://attachments/{id}
+func parseResourceURI(uri string) (string, int, error) {
+	for _, prefix := range []string{messagesURI, imagesURI, attachmentsURI} {
+		if !strings.HasPrefix(uri, prefix+"/") {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimPrefix(uri, prefix+"/"))
+		if err != nil || id <= 0 {
+			break
+		}
+		switch prefix {
+		case imagesURI:
+			return "image", id, nil
+		case attachmentsURI:
+			return "attachment", id, nil
+		}
+		return "text", id, nil
+	}
+	return "", 0, fmt.Errorf("invalid resource URI: %s", uri)
+}
+
+func handleResourcesList(req JSONRPCRequest) *JSONRPCResponse {
+	cursor, _ := req.Params["cursor"].(string)
+	q, err := queryParams{cursor: cursor, typ: "all"}.build(defaultPageSize)
+	if err != nil {
+		return newRPCError(req.ID, -32602, fmt.Sprintf("Invalid params: %v", err))
+	}
+
+	page, nextCursor, err := findPage(q)
+	if err != nil {
+		return newRPCError(req.ID, -32603, fmt.Sprintf("Internal error: %v", err))
+	}
+
+	resources := []map[string]interface{}{}
+	for _, msg := range page {
+		resources = append(resources, resourceInfo(msg))
+	}
+
+	result := map[string]interface{}{"resources": resources}
+	if nextCursor != "" {
+		result["nextCursor"] = nextCursor
+	}
+	return newRPCResult(req.ID, result)
+}
+
+func handleResourcesRead(req JSONRPCRequest) *JSONRPCResponse {
+	uri, _ := req.Params["uri"].(string)
+	typ, id, err := parseResourceURI(uri)
+	if err != nil {
+		return newRPCError(req.ID, -32602, err.Error())
+	}
+
+	msg, err := store.Get(id)
+	if err == errMessageNotFound || (err == nil && msg.Type != typ) {
+		return newRPCError(req.ID, -32002, fmt.Sprintf("Resource not found: %s", uri))
+	}
+	if err != nil {
+		return newRPCError(req.ID, -32603, fmt.Sprintf("Internal error: %v", err))
+	}
+
+	content := map[string]interface{}{"uri": uri}
+	switch msg.Type {
+	case "image", "attachment":
+		data, err := readBlob(msg)
+		if err != nil {
+			return newRPCError(req.ID, -32603, fmt.Sprintf("Internal error: %v", err))
+		}
+		content["mimeType"] = msg.MimeType
+		// 文本附件直接返回文本
+		if msg.Type == "attachment" && strings.HasPrefix(msg.MimeType, "text/") {
+			content["text"] = string(data)
+		} else {
+			content["blob"] = base64.StdEncoding.EncodeToString(data)
+		}
+	default:
+		content["mimeType"] = "text/plain"
+		content["text"] = msg.Text
+	}
+
+	return newRPCResult(req.ID, map[string]interface{}{
+		"contents": []map[string]interface{}{content},
+	})
+}
+
+// 资源订阅，按通知目标（会话 / stdio）记录订阅的 URI
+var (
+	subscriptionMutex sync.Mutex
+	subscriptions     = map[notifier]map[string]bool{}
+)
+
+func handleResourcesSubscribe(ctx context.Context, req JSONRPCRequest, subscribe bool) *JSONRPCResponse {
+	uri, _ := req.Params["uri"].(string)
+	if uri != messagesURI && uri != imagesURI && uri != attachmentsURI {
+		if _, _, err := parseResourceURI(uri); err != nil {
+			return newRPCError(req.ID, -32602, err.Error())
+		}
+	}
+
+	n := notifierFromContext(ctx)
+	if n == nil {
+		return newRPCError(req.ID, -32600, "Subscriptions require an MCP session (Mcp-Session-Id) or stdio transport")
+	}
+
+	subscriptionMutex.Lock()
+	defer subscriptionMutex.Unlock()
+
+	if subscribe {
+		if subscriptions[n] == nil {
+			subscriptions[n] = map[string]bool{}
+		}
+		subscriptions[n][uri] = true
+	} else if subs := subscriptions[n]; subs != nil {
+		delete(subs, uri)
+		if len(subs) == 0 {
+			delete(subscriptions, n)
+		}
+	}
+
+	return newRPCResult(req.ID, map[string]interface{}{})
+}
+
+// 会话结束时清理订阅
+func unsubscribeAll(n notifier) {
+	subscriptionMutex.Lock()
+	delete(subscriptions, n)
+	subscriptionMutex.Unlock()
+}
+
+// 新消息到达：通知资源列表变化，并通知订阅了对应集合或条目的客户端
+func notifyResourceAdded(msg Message) {
+	broadcastNotification("notifications/resources/list_changed", nil)
+
+	collection := collectionURI(msg)
+	item := resourceURI(msg)
+
+	subscriptionMutex.Lock()
+	var targets []notifier
+	var uris []string
+	for n, subs := range subscriptions {
+		for _, uri := range []string{collection, item} {
+			if subs[uri] {
+				targets = append(targets, n)
+				uris = append(uris, uri)
+			}
+		}
+	}
+	subscriptionMutex.Unlock()
+
+	for i, n := range targets {
+		n.notify("notifications/resources/updated", map[string]interface{}{
+			"uri": uris[i],
+		})
+	}
+}
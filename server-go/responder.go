@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// 回复生成器：send_message 和 /message 收到消息后由它生成回复
+type Responder interface {
+	Respond(ctx context.Context, message string) (string, error)
+}
+
+// 支持流式输出的回复生成器，每收到一段文本调用一次 onChunk
+type StreamingResponder interface {
+	Responder
+	RespondStream(ctx context.Context, message string, onChunk func(chunk string)) (string, error)
+}
+
+// 生成回复；不支持流式的回复生成器把完整回复作为一段输出
+func respondStream(ctx context.Context, r Responder, message string, onChunk func(chunk string)) (string, error) {
+	if sr, ok := r.(StreamingResponder); ok {
+		return sr.RespondStream(ctx, message, onChunk)
+	}
+
+	reply, err := r.Respond(ctx, message)
+	if err == nil && reply != "" {
+		onChunk(reply)
+	}
+	return reply, err
+}
+
+// 当前使用的回复生成器
+var responder Responder = randomResponder{}
+
+// 回复生成器配置（来自命令行参数）
+type responderConfig struct {
+	kind        string // echo / random / rules / openai
+	rulesFile   string
+	openaiURL   string
+	openaiModel string
+	openaiKey   string
+	systemMsg   string
+}
+
+func newResponder(cfg responderConfig) (Responder, error) {
+	switch cfg.kind {
+	case "", "random":
+		return randomResponder{}, nil
+	case "echo":
+		return echoResponder{}, nil
+	case "rules":
+		if cfg.rulesFile == "" {
+			return nil, fmt.Errorf("rules 回复需要 --rules 指定规则文件")
+		}
+		return loadRulesResponder(cfg.rulesFile)
+	case "openai":
+		return newOpenAIResponder(cfg.openaiURL, cfg.openaiModel, cfg.openaiKey, cfg.systemMsg)
+	default:
+		return nil, fmt.Errorf("未知的回复类型: %s (可选: echo, random, rules, openai)", cfg.kind)
+	}
+}
+
+// 原样返回收到的消息
+type echoResponder struct{}
+
+func (echoResponder) Respond(ctx context.Context, message string) (string, error) {
+	return message, nil
+}
+
+// 从固定回复表中随机挑选（演示用）
+type randomResponder struct{}
+
+func (randomResponder) Respond(ctx context.Context, message string) (string, error) {
+	return getRandomResponse(), nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OpenAI 兼容的 chat completions 后端（OpenAI、Ollama、vLLM 等）
+type openAIResponder struct {
+	url    string // .../v1/chat/completions
+	model  string
+	key    string
+	system string
+	client *http.Client
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model    string        `json:"model"`
+	Messages []chatMessage `json:"messages"`
+	Stream   bool          `json:"stream,omitempty"`
+}
+
+// 流式响应的一段
+type chatChunk struct {
+	Choices []struct {
+		Delta chatMessage `json:"delta"`
+	} `json:"choices"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+func newOpenAIResponder(baseURL, model, key, system string) (*openAIResponder, error) {
+	if baseURL == "" {
+		baseURL = "https://api.openai.com/v1"
+	}
+	if model == "" {
+		return nil, fmt.Errorf("openai 回复需要 --openai-model 指定模型")
+	}
+
+	// 允许传 base URL 或完整的 endpoint
+	url := strings.TrimSuffix(baseURL, "/")
+	if !strings.HasSuffix(url, "/chat/completions") {
+		url += "/chat/completions"
+	}
+
+	return &openAIResponder{
+		url:    url,
+		model:  model,
+		key:    key,
+		system: system,
+		client: &http.Client{Timeout: 2 * time.Minute},
+	}, nil
+}
+
+func (o *openAIResponder) messages(message string) []chatMessage {
+	var msgs []chatMessage
+	if o.system != "" {
+		msgs = append(msgs, chatMessage{Role: "system", Content: o.system})
+	}
+	return append(msgs, chatMessage{Role: "user", Content: message})
+}
+
+func (o *openAIResponder) newRequest(ctx context.Context, body chatRequest) (*http.Request, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.key != "" {
+		req.Header.Set("Authorization", "Bearer "+o.key)
+	}
+	return req, nil
+}
+
+func (o *openAIResponder) Respond(ctx context.Context, message string) (string, error) {
+	req, err := o.newRequest(ctx, chatRequest{
+		Model:    o.model,
+		Messages: o.messages(message),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 10*1024*1024))
+	if err != nil {
+		return "", err
+	}
+
+	var result chatResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return "", fmt.Errorf("chat completions 返回了无效 JSON (HTTP %d)", resp.StatusCode)
+	}
+	if result.Error != nil {
+		return "", fmt.Errorf("chat completions 错误: %s", result.Error.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("chat completions 返回 HTTP %d", resp.StatusCode)
+	}
+	if len(result.Choices) == 0 {
+		return "", fmt.Errorf("chat completions 没有返回结果")
+	}
+
+	return result.Choices[0].Message.Content, nil
+}
+
+func (o *openAIResponder) RespondStream(ctx context.Context, message string, onChunk func(chunk string)) (string, error) {
+	req, err := o.newRequest(ctx, chatRequest{
+		Model:    o.model,
+		Messages: o.messages(message),
+		Stream:   true,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var result chatResponse
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+		if json.Unmarshal(data, &result) == nil && result.Error != nil {
+			return "", fmt.Errorf("chat completions 错误: %s", result.Error.Message)
+		}
+		return "", fmt.Errorf("chat completions 返回 HTTP %d", resp.StatusCode)
+	}
+
+	var reply strings.Builder
+	errDone := errors.New("done")
+	err = readSSE(resp.Body, func(event, data string) error {
+		if data == "[DONE]" {
+			return errDone
+		}
+
+		var chunk chatChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("chat completions 返回了无效的流数据")
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			text := chunk.Choices[0].Delta.Content
+			reply.WriteString(text)
+			onChunk(text)
+		}
+		return nil
+	})
+	if err != nil && err != errDone {
+		return reply.String(), err
+	}
+
+	return reply.String(), nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 规则文件格式（YAML 或 JSON）：
+//
+//	rules:
+//	  - match: "^ping$"
+//	    reply: "pong"
+//	  - match: "(?i)^hello (\\w+)"
+//	    reply: "Hi $1!"
+//	default: "收到"
+//
+// reply 中可以用 $1、${name} 引用 match 的捕获组
+type rulesFile struct {
+	Rules []struct {
+		Match string `yaml:"match"`
+		Reply string `yaml:"reply"`
+	} `yaml:"rules"`
+	Default string `yaml:"default"`
+}
+
+type rule struct {
+	re    *regexp.Regexp
+	reply string
+}
+
+// 按顺序匹配正则，返回第一条命中规则的回复
+type rulesResponder struct {
+	rules    []rule
+	fallback string
+}
+
+func loadRulesResponder(path string) (*rulesResponder, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// YAML 是 JSON 的超集，两种格式都能解析
+	var file rulesFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("解析规则文件失败: %v", err)
+	}
+
+	r := &rulesResponder{fallback: file.Default}
+	for i, item := range file.Rules {
+		re, err := regexp.Compile(item.Match)
+		if err != nil {
+			return nil, fmt.Errorf("规则 %d 的正则无效: %v", i+1, err)
+		}
+		r.rules = append(r.rules, rule{re: re, reply: item.Reply})
+	}
+	return r, nil
+}
+
+func (r *rulesResponder) Respond(ctx context.Context, message string) (string, error) {
+	for _, rule := range r.rules {
+		match := rule.re.FindStringSubmatchIndex(message)
+		if match == nil {
+			continue
+		}
+		return string(rule.re.ExpandString(nil, rule.reply, message, match)), nil
+	}
+
+	if r.fallback != "" {
+		return r.fallback, nil
+	}
+	return "收到", nil
+}
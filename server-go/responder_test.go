@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 本地的 chat completions 桩服务器，记录收到的请求
+func newChatStub(t *testing.T, handler func(w http.ResponseWriter, req chatRequest)) (*httptest.Server, *[]*http.Request) {
+	t.Helper()
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/chat/completions" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		var req chatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		handler(w, req)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestNewOpenAIResponderURL(t *testing.T) {
+	tests := []struct {
+		base string
+		want string
+	}{
+		{"", "https://api.openai.com/v1/chat/completions"},
+		{"http://localhost:11434/v1", "http://localhost:11434/v1/chat/completions"},
+		{"http://localhost:11434/v1/", "http://localhost:11434/v1/chat/completions"},
+		{"http://localhost:8000/v1/chat/completions", "http://localhost:8000/v1/chat/completions"},
+	}
+	for _, tt := range tests {
+		o, err := newOpenAIResponder(tt.base, "m", "", "")
+		if err != nil {
+			t.Fatalf("newOpenAIResponder(%q): %v", tt.base, err)
+		}
+		if o.url != tt.want {
+			t.Errorf("newOpenAIResponder(%q).url = %q, want %q", tt.base, o.url, tt.want)
+		}
+	}
+
+	if _, err := newOpenAIResponder("", "", "", ""); err == nil {
+		t.Error("newOpenAIResponder without model: want error")
+	}
+}
+
+func TestOpenAIResponderRespond(t *testing.T) {
+	var got chatRequest
+	server, requests := newChatStub(t, func(w http.ResponseWriter, req chatRequest) {
+		got = req
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"pong"}}]}`)
+	})
+
+	o, err := newOpenAIResponder(server.URL+"/v1", "test-model", "sk-test", "be brief")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := o.Respond(context.Background(), "ping")
+	if err != nil {
+		t.Fatalf("Respond: %v", err)
+	}
+	if reply != "pong" {
+		t.Errorf("reply = %q, want %q", reply, "pong")
+	}
+
+	if auth := (*requests)[0].Header.Get("Authorization"); auth != "Bearer sk-test" {
+		t.Errorf("Authorization = %q", auth)
+	}
+	want := chatRequest{
+		Model: "test-model",
+		Messages: []chatMessage{
+			{Role: "system", Content: "be brief"},
+			{Role: "user", Content: "ping"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("request = %+v, want %+v", got, want)
+	}
+}
+
+func TestOpenAIResponderRespondError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"api error", http.StatusUnauthorized, `{"error":{"message":"invalid api key"}}`, "invalid api key"},
+		{"http status", http.StatusBadGateway, `{}`, "HTTP 502"},
+		{"invalid json", http.StatusOK, `not json`, "无效 JSON"},
+		{"no choices", http.StatusOK, `{"choices":[]}`, "没有返回结果"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := newChatStub(t, func(w http.ResponseWriter, req chatRequest) {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			})
+			o, _ := newOpenAIResponder(server.URL+"/v1", "m", "", "")
+
+			for _, stream := range []bool{false, true} {
+				// 流式请求只检查非 200 的情况
+				if stream && tt.status == http.StatusOK {
+					continue
+				}
+				var err error
+				if stream {
+					_, err = o.RespondStream(context.Background(), "hi", func(string) {})
+				} else {
+					_, err = o.Respond(context.Background(), "hi")
+				}
+				if err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("stream=%v: err = %v, want %q", stream, err, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenAIResponderRespondStream(t *testing.T) {
+	var got chatRequest
+	server, _ := newChatStub(t, func(w http.ResponseWriter, req chatRequest) {
+		got = req
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, text := range []string{"Hel", "", "lo", " world"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", text)
+			w.(http.Flusher).Flush()
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+		// [DONE] 之后的数据被忽略
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"!\"}}]}\n\n")
+	})
+
+	o, _ := newOpenAIResponder(server.URL+"/v1", "m", "", "")
+	var chunks []string
+	reply, err := respondStream(context.Background(), o, "hi", func(chunk string) {
+		chunks = append(chunks, chunk)
+	})
+	if err != nil {
+		t.Fatalf("RespondStream: %v", err)
+	}
+	if !got.Stream {
+		t.Error("request stream = false, want true")
+	}
+	if reply != "Hello world" {
+		t.Errorf("reply = %q, want %q", reply, "Hello world")
+	}
+	if want := []string{"Hel", "lo", " world"}; !reflect.DeepEqual(chunks, want) {
+		t.Errorf("chunks = %q, want %q", chunks, want)
+	}
+}
+
+func TestOpenAIResponderRespondStreamInvalid(t *testing.T) {
+	server, _ := newChatStub(t, func(w http.ResponseWriter, req chatRequest) {
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"par\"}}]}\n\ndata: oops\n\n")
+	})
+
+	o, _ := newOpenAIResponder(server.URL+"/v1", "m", "", "")
+	reply, err := o.RespondStream(context.Background(), "hi", func(string) {})
+	if err == nil || !strings.Contains(err.Error(), "无效的流数据") {
+		t.Errorf("err = %v, want invalid stream error", err)
+	}
+	if reply != "par" {
+		t.Errorf("partial reply = %q, want %q", reply, "par")
+	}
+}
+
+func writeRulesFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRulesResponder(t *testing.T) {
+	path := writeRulesFile(t, `
+rules:
+  - match: "^ping$"
+    reply: "pong"
+  - match: "(?i)^hello (\\w+)"
+    reply: "Hi $1!"
+  - match: "^deploy (?P<service>\\w+) to (?P<env>\\w+)$"
+    reply: "deploying ${service} -> ${env}"
+  - match: "(\\d+)\\+(\\d+)"
+    reply: "${1}plus${2}"
+  - match: "^ping"
+    reply: "prefix"
+default: "fallback"
+`)
+	r, err := loadRulesResponder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		message string
+		want    string
+	}{
+		{"ping", "pong"},
+		{"ping again", "prefix"},
+		{"HELLO bob and alice", "Hi bob!"},
+		{"deploy api to prod", "deploying api -> prod"},
+		{"sum 1+2", "1plus2"},
+		{"something else", "fallback"},
+		{"", "fallback"},
+	}
+	for _, tt := range tests {
+		got, err := r.Respond(context.Background(), tt.message)
+		if err != nil {
+			t.Fatalf("Respond(%q): %v", tt.message, err)
+		}
+		if got != tt.want {
+			t.Errorf("Respond(%q) = %q, want %q", tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestRulesResponderDefault(t *testing.T) {
+	// JSON 格式，没有 default 时回复 "收到"
+	r, err := loadRulesResponder(writeRulesFile(t, `{"rules": [{"match": "^a$", "reply": "b"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := r.Respond(context.Background(), "x"); got != "收到" {
+		t.Errorf("fallback = %q, want %q", got, "收到")
+	}
+	if got, _ := r.Respond(context.Background(), "a"); got != "b" {
+		t.Errorf("Respond(a) = %q, want %q", got, "b")
+	}
+}
+
+func TestLoadRulesResponderInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"bad regexp", "rules:\n  - match: \"(\"\n    reply: x\n", "规则 1 的正则无效"},
+		{"bad yaml", "rules: [", "解析规则文件失败"},
+	}
+	for _, tt := range tests {
+		_, err := loadRulesResponder(writeRulesFile(t, tt.content))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JSON-RPC 通知（没有 id）
+type JSONRPCNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+// 可以接收服务器推送通知的一端（SSE 会话、stdio）
+type notifier interface {
+	notify(method string, params interface{})
+}
+
+func newNotification(method string, params interface{}) []byte {
+	data, _ := json.Marshal(JSONRPCNotification{
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  params,
+	})
+	return data
+}
+
+// SSE 流（GET /mcp 打开）
+type sseStream struct {
+	ch chan []byte
+}
+
+// MCP 会话（Streamable HTTP 传输）
+type mcpSession struct {
+	id       string
+	done     chan struct{} // 会话结束时关闭
+	mu       sync.Mutex
+	streams  map[*sseStream]struct{}
+	lastSeen time.Time // 最后一次请求或流关闭的时间
+}
+
+// 大多数客户端不会发送 DELETE /mcp：没有打开的流且空闲超过 sessionIdleTimeout 的会话被清理，
+// 会话数达到 maxSessions 时结束最久未使用的会话
+const (
+	sessionIdleTimeout = 30 * time.Minute
+	maxSessions        = 1000
+)
+
+func (s *mcpSession) touch() {
+	s.mu.Lock()
+	s.lastSeen = time.Now()
+	s.mu.Unlock()
+}
+
+// 没有打开的流时返回空闲时长
+func (s *mcpSession) idle(now time.Time) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return now.Sub(s.lastSeen), len(s.streams) == 0
+}
+
+func (s *mcpSession) addStream() *sseStream {
+	stream := &sseStream{ch: make(chan []byte, 64)}
+	s.mu.Lock()
+	s.streams[stream] = struct{}{}
+	s.mu.Unlock()
+	return stream
+}
+
+func (s *mcpSession) removeStream(stream *sseStream) {
+	s.mu.Lock()
+	delete(s.streams, stream)
+	s.lastSeen = time.Now()
+	s.mu.Unlock()
+}
+
+func (s *mcpSession) notify(method string, params interface{}) {
+	data := newNotification(method, params)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for stream := range s.streams {
+		select {
+		case stream.ch <- data:
+		default:
+			// 客户端读得太慢，丢弃而不是阻塞
+			log.Printf("⚠️  SSE 缓冲已满，丢弃通知: %s", method)
+		}
+	}
+}
+
+var (
+	sessionMutex sync.RWMutex
+	sessions     = map[string]*mcpSession{}
+	// 未携带 Mcp-Session-Id 的 GET 流挂在这里
+	defaultSession = &mcpSession{done: make(chan struct{}), streams: map[*sseStream]struct{}{}}
+	// stdio 模式下的对端
+	stdioPeer notifier
+)
+
+func newSession() *mcpSession {
+	now := time.Now()
+	s := &mcpSession{
+		id:       generateToken(),
+		done:     make(chan struct{}),
+		streams:  map[*sseStream]struct{}{},
+		lastSeen: now,
+	}
+	sessionMutex.Lock()
+	pruneSessions(now)
+	sessions[s.id] = s
+	sessionMutex.Unlock()
+	return s
+}
+
+// 清理空闲会话，数量仍然达到上限时结束最久未使用的会话；调用时持有 sessionMutex
+func pruneSessions(now time.Time) {
+	var oldest *mcpSession
+	var oldestIdle time.Duration
+	for _, s := range sessions {
+		idle, noStreams := s.idle(now)
+		if noStreams && idle > sessionIdleTimeout {
+			endSession(s)
+			continue
+		}
+		if oldest == nil || idle > oldestIdle {
+			oldest, oldestIdle = s, idle
+		}
+	}
+	if len(sessions) >= maxSessions && oldest != nil {
+		log.Printf("⚠️  MCP 会话数达到上限 %d，结束最久未使用的会话", maxSessions)
+		endSession(oldest)
+	}
+}
+
+// 移除会话并结束它的 SSE 流；调用时持有 sessionMutex
+func endSession(s *mcpSession) {
+	delete(sessions, s.id)
+	close(s.done)
+	unsubscribeAll(s)
+}
+
+func getSession(id string) *mcpSession {
+	sessionMutex.RLock()
+	defer sessionMutex.RUnlock()
+	s := sessions[id]
+	if s != nil {
+		s.touch()
+	}
+	return s
+}
+
+func deleteSession(id string) bool {
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+	s, ok := sessions[id]
+	if !ok {
+		return false
+	}
+	endSession(s)
+	return true
+}
+
+// 服务器关闭时结束所有会话和 SSE 流
+func closeAllSessions() {
+	sessionMutex.Lock()
+	for _, s := range sessions {
+		endSession(s)
+	}
+	sessionMutex.Unlock()
+
+	select {
+	case <-defaultSession.done:
+	default:
+		close(defaultSession.done)
+	}
+}
+
+// 向所有连接的客户端推送通知
+func broadcastNotification(method string, params interface{}) {
+	sessionMutex.RLock()
+	targets := make([]notifier, 0, len(sessions)+2)
+	for _, s := range sessions {
+		targets = append(targets, s)
+	}
+	sessionMutex.RUnlock()
+
+	targets = append(targets, defaultSession)
+	if stdioPeer != nil {
+		targets = append(targets, stdioPeer)
+	}
+
+	for _, t := range targets {
+		t.notify(method, params)
+	}
+}
+
+// 推送一条日志通知（notifications/message）
+func broadcastLog(level string, data interface{}) {
+	broadcastNotification("notifications/message", map[string]interface{}{
+		"level":  level,
+		"logger": "cicy",
+		"data":   data,
+	})
+}
+
+func acceptsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+func writeSSEHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+}
+
+func writeSSEEvent(w http.ResponseWriter, event string, data []byte) {
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// 逐个读取 SSE 事件，直到流结束或 fn 返回错误
+// 没有 event 字段的事件按 "message" 处理
+func readSSE(r io.Reader, fn func(event, data string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	event := ""
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				if event == "" {
+					event = "message"
+				}
+				if err := fn(event, strings.Join(data, "\n")); err != nil {
+					return err
+				}
+			}
+			event, data = "", nil
+		case strings.HasPrefix(line, ":"):
+			// 注释（keepalive）
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// 流结束时没有空行收尾
+	if len(data) > 0 {
+		if event == "" {
+			event = "message"
+		}
+		return fn(event, strings.Join(data, "\n"))
+	}
+	return nil
+}
+
+// POST 响应升级为 SSE 时，请求相关的通知（如进度）写到同一个流里
+type postStream struct {
+	mu sync.Mutex
+	w  http.ResponseWriter
+}
+
+func (p *postStream) send(data []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	writeSSEEvent(p.w, "message", data)
+}
+
+func (p *postStream) notify(method string, params interface{}) {
+	p.send(newNotification(method, params))
+}
+
+type notifierKey struct{}
+
+// 把当前请求的通知目标放进 context，工具调用可以借此发送进度
+func withNotifier(ctx context.Context, n notifier) context.Context {
+	if n == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, notifierKey{}, n)
+}
+
+func notifierFromContext(ctx context.Context) notifier {
+	n, _ := ctx.Value(notifierKey{}).(notifier)
+	return n
+}
+
+// GET /mcp：打开 SSE 流接收服务器推送
+func mcpStreamHandler(w http.ResponseWriter, r *http.Request) {
+	if !acceptsEventStream(r) {
+		http.Error(w, "Accept must include text/event-stream", http.StatusNotAcceptable)
+		return
+	}
+	if _, ok := w.(http.Flusher); !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	session := defaultSession
+	if id := r.Header.Get("Mcp-Session-Id"); id != "" {
+		session = getSession(id)
+		if session == nil {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	stream := session.addStream()
+	defer session.removeStream(stream)
+
+	writeSSEHeaders(w)
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+
+	keepalive := time.NewTicker(30 * time.Second)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-session.done:
+			return
+		case data := <-stream.ch:
+			writeSSEEvent(w, "message", data)
+		case <-keepalive.C:
+			fmt.Fprint(w, ": ping\n\n")
+			w.(http.Flusher).Flush()
+		}
+	}
+}
+
+// DELETE /mcp：结束会话
+func mcpDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.Header.Get("Mcp-Session-Id")
+	if id == "" {
+		http.Error(w, "Mcp-Session-Id required", http.StatusBadRequest)
+		return
+	}
+	if !deleteSession(id) {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// 内置 SSH 客户端：每个主机保持一个已认证的连接，/ssh 选择主机时建立，/exit 或退出 TUI 时关闭
+//
+// 认证依次尝试 ssh-agent（SSH_AUTH_SOCK）和 IdentityFile（未配置时为 ~/.ssh/id_ed25519 等默认私钥），
+// 主机密钥按 ~/.ssh/known_hosts 校验，未知主机会被拒绝。
+// 连接每 30 秒发送一次 keepalive，断开后下次执行命令时自动重连。
+const (
+	sshDialTimeout       = 10 * time.Second
+	sshKeepaliveInterval = 30 * time.Second
+)
+
+var defaultIdentityFiles = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+func sshDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ".ssh"
+	}
+	return filepath.Join(homeDir, ".ssh")
+}
+
+func currentUser() string {
+	for _, key := range []string{"USER", "USERNAME"} {
+		if u := os.Getenv(key); u != "" {
+			return u
+		}
+	}
+	return "root"
+}
+
+// 认证方式：ssh-agent 中的密钥优先，然后是私钥文件（跳过有密码的私钥）
+//
+// 所有密钥放在同一个 publickey 方法中：x/crypto/ssh 对同名的方法只尝试一次，
+// 分开时 agent 中没有可用的密钥会导致私钥文件不被尝试。
+// 返回的 agentConn 是到 ssh-agent 的连接（没有时为 nil），握手完成后由调用者关闭
+func sshAuthMethods(h sshHostConfig) (methods []ssh.AuthMethod, agentConn net.Conn) {
+	var agentClient agent.ExtendedAgent
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			agentConn, agentClient = conn, agent.NewClient(conn)
+		}
+	}
+
+	files := h.IdentityFiles
+	if len(files) == 0 {
+		for _, name := range defaultIdentityFiles {
+			files = append(files, filepath.Join(sshDir(), name))
+		}
+	}
+	var signers []ssh.Signer
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			log.Printf("⚠️  跳过私钥 %s: %v", file, err)
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	if agentClient == nil && len(signers) == 0 {
+		return nil, nil
+	}
+	return []ssh.AuthMethod{ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+		var all []ssh.Signer
+		if agentClient != nil {
+			if agentSigners, err := agentClient.Signers(); err == nil {
+				all = agentSigners
+			}
+		}
+		return append(all, signers...), nil
+	})}, agentConn
+}
+
+// 按 known_hosts 校验主机密钥；返回该主机已记录的密钥算法，让服务器优先出示这些类型的密钥
+func sshHostKeyCallback(addr string) (ssh.HostKeyCallback, []string, error) {
+	path := filepath.Join(sshDir(), "known_hosts")
+	if !fileExists(path) {
+		return nil, nil, fmt.Errorf("未知主机 %s，请先用 ssh 连接一次以记录主机密钥", addr)
+	}
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("无法读取 known_hosts: %v", err)
+	}
+
+	// 用一个不存在的密钥查询，KeyError.Want 是已记录的密钥
+	placeholder, _ := ssh.NewPublicKey(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)))
+	var keyErr *knownhosts.KeyError
+	var algorithms []string
+	if err := callback(addr, &net.TCPAddr{}, placeholder); errors.As(err, &keyErr) {
+		for _, known := range keyErr.Want {
+			if known.Key.Type() == ssh.KeyAlgoRSA {
+				algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256)
+			}
+			algorithms = append(algorithms, known.Key.Type())
+		}
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := callback(hostname, remote, key)
+		if errors.As(err, &keyErr) {
+			if len(keyErr.Want) == 0 {
+				return fmt.Errorf("未知主机 %s，请先用 ssh 连接一次以记录主机密钥", hostname)
+			}
+			return fmt.Errorf("主机密钥与 known_hosts 不一致: %s", hostname)
+		}
+		return err
+	}, algorithms, nil
+}
+
+func dialSSH(alias string) (*ssh.Client, error) {
+	h := lookupSSHHost(alias)
+	hostKeyCallback, algorithms, err := sshHostKeyCallback(h.addr())
+	if err != nil {
+		return nil, err
+	}
+	methods, agentConn := sshAuthMethods(h)
+	if agentConn != nil {
+		// 认证只在握手时使用 agent
+		defer agentConn.Close()
+	}
+	if len(methods) == 0 {
+		return nil, errors.New("没有可用的私钥或 ssh-agent")
+	}
+	return ssh.Dial("tcp", h.addr(), &ssh.ClientConfig{
+		User:              h.User,
+		Auth:              methods,
+		HostKeyCallback:   hostKeyCallback,
+		HostKeyAlgorithms: algorithms,
+		Timeout:           sshDialTimeout,
+	})
+}
+
+// 每个主机一个连接
+type sshConn struct {
+	client *ssh.Client
+	done   chan struct{}
+}
+
+// 正在建立的连接，同一主机的其他调用者等待它完成
+type sshDial struct {
+	done   chan struct{}
+	client *ssh.Client
+	err    error
+}
+
+var sshPool = struct {
+	sync.Mutex
+	conns   map[string]*sshConn
+	dialing map[string]*sshDial
+}{conns: map[string]*sshConn{}, dialing: map[string]*sshDial{}}
+
+// 返回主机的连接，没有时建立新连接；建立连接时不持有 sshPool 的锁，不会阻塞其他主机
+func sshConnect(host string) (*ssh.Client, error) {
+	sshPool.Lock()
+	if c := sshPool.conns[host]; c != nil {
+		sshPool.Unlock()
+		return c.client, nil
+	}
+	if d := sshPool.dialing[host]; d != nil {
+		sshPool.Unlock()
+		<-d.done
+		return d.client, d.err
+	}
+	d := &sshDial{done: make(chan struct{})}
+	sshPool.dialing[host] = d
+	sshPool.Unlock()
+
+	client, err := dialSSH(host)
+
+	sshPool.Lock()
+	if sshPool.dialing[host] != d {
+		// 连接期间主机被断开（/exit 或退出 TUI）
+		if err == nil {
+			client.Close()
+			client, err = nil, fmt.Errorf("SSH 连接已关闭: %s", host)
+		}
+	} else {
+		delete(sshPool.dialing, host)
+		if err == nil {
+			c := &sshConn{client: client, done: make(chan struct{})}
+			sshPool.conns[host] = c
+			go sshKeepalive(host, c)
+			log.Printf("🔗 SSH 已连接: %s", host)
+		}
+	}
+	sshPool.Unlock()
+
+	d.client, d.err = client, err
+	close(d.done)
+	return client, err
+}
+
+// 定期发送 keepalive，失败时把连接移出连接池
+func sshKeepalive(host string, c *sshConn) {
+	ticker := time.NewTicker(sshKeepaliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			// 网络中断时请求可能一直没有响应
+			result := make(chan error, 1)
+			go func() {
+				_, _, err := c.client.SendRequest("keepalive@openssh.com", true, nil)
+				result <- err
+			}()
+			var err error
+			select {
+			case err = <-result:
+			case <-time.After(sshDialTimeout):
+				err = errors.New("keepalive timeout")
+			}
+			if err != nil {
+				log.Printf("⚠️  SSH 连接已断开: %s (%v)", host, err)
+				sshDrop(host, c)
+				return
+			}
+		}
+	}
+}
+
+// 关闭并移除连接（已被替换的连接只关闭）
+func sshDrop(host string, c *sshConn) {
+	sshPool.Lock()
+	if sshPool.conns[host] == c {
+		delete(sshPool.conns, host)
+	}
+	sshPool.Unlock()
+	c.close()
+}
+
+func (c *sshConn) close() {
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+		c.client.Close()
+	}
+}
+
+func sshDisconnect(host string) {
+	closeRemoteShell(host)
+	sshPool.Lock()
+	c := sshPool.conns[host]
+	delete(sshPool.dialing, host)
+	sshPool.Unlock()
+	if c != nil {
+		sshDrop(host, c)
+	}
+}
+
+func sshDisconnectAll() {
+	closeAllRemoteShells()
+	sshPool.Lock()
+	conns := sshPool.conns
+	sshPool.conns = map[string]*sshConn{}
+	sshPool.dialing = map[string]*sshDial{}
+	sshPool.Unlock()
+	for _, c := range conns {
+		c.close()
+	}
+}
+
+// 打开新的 session；连接已失效时重连一次
+func sshSession(host string) (*ssh.Session, error) {
+	client, err := sshConnect(host)
+	if err != nil {
+		return nil, err
+	}
+	session, err := client.NewSession()
+	if err == nil {
+		return session, nil
+	}
+
+	sshPool.Lock()
+	c := sshPool.conns[host]
+	sshPool.Unlock()
+	if c != nil && c.client == client {
+		sshDrop(host, c)
+	}
+	log.Printf("🔄 SSH 重新连接: %s (%v)", host, err)
+	if client, err = sshConnect(host); err != nil {
+		return nil, err
+	}
+	return client.NewSession()
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ~/.ssh/config 解析
+//
+//   - 关键字不区分大小写，支持 `Key value` 和 `Key=value`，值可以用双引号
+//   - Host 可以有多个模式，支持 * ? 和 ! 否定
+//   - Include 支持通配符，相对路径相对于 ~/.ssh；写在 Host 块中时只对该块的主机生效
+//   - Match 块不支持，其中的参数（包括 Include）都会被跳过
+//
+// 与 ssh 相同，每个参数取第一次出现的值（IdentityFile 可以有多个）
+const maxSSHIncludeDepth = 16
+
+type sshOption struct {
+	key   string // 小写
+	value string
+}
+
+type sshConfigBlock struct {
+	patterns []string        // nil 表示第一个 Host 之前的参数，对所有主机生效
+	match    bool            // Match 块，不会匹配任何主机
+	parent   *sshConfigBlock // Include 所在的块
+	options  []sshOption
+}
+
+func (b *sshConfigBlock) matches(alias string) bool {
+	for ; b != nil; b = b.parent {
+		if b.match || (b.patterns != nil && !matchSSHPatterns(b.patterns, alias)) {
+			return false
+		}
+	}
+	return true
+}
+
+type sshConfig struct {
+	blocks []*sshConfigBlock
+}
+
+func loadSSHConfig() *sshConfig {
+	c := &sshConfig{}
+	c.read(filepath.Join(sshDir(), "config"), nil, 0)
+	return c
+}
+
+func (c *sshConfig) read(path string, parent *sshConfigBlock, depth int) {
+	if depth > maxSSHIncludeDepth {
+		log.Printf("⚠️  SSH 配置 Include 层数过多: %s", path)
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	current := &sshConfigBlock{parent: parent}
+	c.blocks = append(c.blocks, current)
+	for _, line := range strings.Split(string(data), "\n") {
+		key, args := parseSSHConfigLine(line)
+		switch key {
+		case "":
+		case "host":
+			current = &sshConfigBlock{patterns: args, parent: parent}
+			c.blocks = append(c.blocks, current)
+		case "match":
+			current = &sshConfigBlock{match: true, parent: parent}
+			c.blocks = append(c.blocks, current)
+		case "include":
+			for _, pattern := range args {
+				for _, file := range sshIncludeFiles(pattern) {
+					c.read(file, current, depth+1)
+				}
+			}
+			// Include 之后的参数排在被包含的文件之后
+			current = &sshConfigBlock{patterns: current.patterns, match: current.match, parent: current.parent}
+			c.blocks = append(c.blocks, current)
+		default:
+			if len(args) > 0 {
+				current.options = append(current.options, sshOption{key: key, value: strings.Join(args, " ")})
+			}
+		}
+	}
+}
+
+// 拆分一行为小写关键字和参数；空行和注释返回空关键字
+func parseSSHConfigLine(line string) (string, []string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil
+	}
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return strings.ToLower(line), nil
+	}
+	key := strings.ToLower(line[:end])
+	rest := strings.TrimSpace(line[end:])
+	rest = strings.TrimSpace(strings.TrimPrefix(rest, "="))
+
+	var args []string
+	for rest != "" {
+		var arg string
+		if rest[0] == '"' {
+			closing := strings.IndexByte(rest[1:], '"')
+			if closing < 0 {
+				arg, rest = rest[1:], ""
+			} else {
+				arg, rest = rest[1:closing+1], rest[closing+2:]
+			}
+		} else if i := strings.IndexAny(rest, " \t"); i >= 0 {
+			arg, rest = rest[:i], rest[i:]
+		} else {
+			arg, rest = rest, ""
+		}
+		args = append(args, arg)
+		rest = strings.TrimSpace(rest)
+	}
+	return key, args
+}
+
+func sshIncludeFiles(pattern string) []string {
+	pattern = expandHome(pattern)
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(sshDir(), pattern)
+	}
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		log.Printf("⚠️  SSH 配置 Include 无效: %s", pattern)
+	}
+	return files
+}
+
+// 任一模式匹配且没有否定模式匹配
+func matchSSHPatterns(patterns []string, host string) bool {
+	host = strings.ToLower(host)
+	matched := false
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if strings.HasPrefix(pattern, "!") {
+			if matchWildcard(pattern[1:], host) {
+				return false
+			}
+		} else if matchWildcard(pattern, host) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// ssh 的通配符：* 匹配任意字符串，? 匹配一个字符
+func matchWildcard(pattern, s string) bool {
+	for pattern != "" {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if matchWildcard(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+			s = s[1:]
+		default:
+			if s == "" || s[0] != pattern[0] {
+				return false
+			}
+			s = s[1:]
+		}
+		pattern = pattern[1:]
+	}
+	return s == ""
+}
+
+// ~/.ssh/config 中一个主机的连接参数
+type sshHostConfig struct {
+	Alias         string
+	HostName      string
+	User          string
+	Port          int
+	IdentityFiles []string
+}
+
+func (h sshHostConfig) addr() string {
+	return net.JoinHostPort(h.HostName, strconv.Itoa(h.Port))
+}
+
+// 主机选择列表中显示的 user@hostname:port
+func (h sshHostConfig) summary() string {
+	return fmt.Sprintf("%s@%s:%d", h.User, h.HostName, h.Port)
+}
+
+func (c *sshConfig) lookup(alias string) sshHostConfig {
+	h := sshHostConfig{Alias: alias}
+	for _, b := range c.blocks {
+		if !b.matches(alias) {
+			continue
+		}
+		for _, opt := range b.options {
+			switch opt.key {
+			case "hostname":
+				if h.HostName == "" {
+					h.HostName = strings.ReplaceAll(opt.value, "%h", alias)
+				}
+			case "user":
+				if h.User == "" {
+					h.User = opt.value
+				}
+			case "port":
+				if h.Port == 0 {
+					h.Port, _ = strconv.Atoi(opt.value)
+				}
+			case "identityfile":
+				h.IdentityFiles = append(h.IdentityFiles, expandHome(opt.value))
+			}
+		}
+	}
+
+	if h.HostName == "" {
+		h.HostName = alias
+	}
+	if h.User == "" {
+		h.User = currentUser()
+	}
+	if h.Port == 0 {
+		h.Port = 22
+	}
+	return h
+}
+
+// Host 中不含通配符的名字，按出现顺序去重
+func (c *sshConfig) aliases() []string {
+	var aliases []string
+	seen := map[string]bool{}
+	for _, b := range c.blocks {
+		if b.match {
+			continue
+		}
+		for _, pattern := range b.patterns {
+			// 条件 Include 中的 Host 只有同时匹配外层块时才可用
+			if strings.ContainsAny(pattern, "*?!") || seen[pattern] || !b.matches(pattern) {
+				continue
+			}
+			seen[pattern] = true
+			aliases = append(aliases, pattern)
+		}
+	}
+	return aliases
+}
+
+func lookupSSHHost(alias string) sshHostConfig {
+	return loadSSHConfig().lookup(alias)
+}
+
+// /ssh 选择列表中的主机
+func getSSHHosts() []sshHostConfig {
+	c := loadSSHConfig()
+	var hosts []sshHostConfig
+	for _, alias := range c.aliases() {
+		hosts = append(hosts, c.lookup(alias))
+	}
+	return hosts
+}
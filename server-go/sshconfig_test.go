@@ -0,0 +1,165 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// 在临时 HOME 的 ~/.ssh 中写入配置文件
+func writeSSHConfig(t *testing.T, files map[string]string) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("USER", "me")
+	for name, content := range files {
+		path := filepath.Join(home, ".ssh", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return home
+}
+
+func TestParseSSHConfigLine(t *testing.T) {
+	tests := []struct {
+		line string
+		key  string
+		args []string
+	}{
+		{"", "", nil},
+		{"   # comment", "", nil},
+		{"Host web db", "host", []string{"web", "db"}},
+		{"HostName=example.com", "hostname", []string{"example.com"}},
+		{"  User = bob  ", "user", []string{"bob"}},
+		{"\tPort\t2222", "port", []string{"2222"}},
+		{`IdentityFile "~/my keys/id_ed25519"`, "identityfile", []string{"~/my keys/id_ed25519"}},
+		{`Host "a b" c`, "host", []string{"a b", "c"}},
+		{`IdentityFile "unterminated value`, "identityfile", []string{"unterminated value"}},
+		{"Compression", "compression", nil},
+	}
+	for _, tt := range tests {
+		key, args := parseSSHConfigLine(tt.line)
+		if key != tt.key || !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("parseSSHConfigLine(%q) = %q, %q, want %q, %q", tt.line, key, args, tt.key, tt.args)
+		}
+	}
+}
+
+func TestMatchSSHPatterns(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		host     string
+		want     bool
+	}{
+		{[]string{"web"}, "web", true},
+		{[]string{"web"}, "WEB", true},
+		{[]string{"web"}, "web2", false},
+		{[]string{"web*"}, "web2", true},
+		{[]string{"web?"}, "web12", false},
+		{[]string{"*.example.com"}, "a.example.com", true},
+		{[]string{"*", "!db"}, "web", true},
+		{[]string{"*", "!db"}, "db", false},
+		{[]string{"!db", "*"}, "db", false},
+		{[]string{"!db"}, "web", false}, // 只有否定模式时不匹配任何主机
+	}
+	for _, tt := range tests {
+		if got := matchSSHPatterns(tt.patterns, tt.host); got != tt.want {
+			t.Errorf("matchSSHPatterns(%q, %q) = %v, want %v", tt.patterns, tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestSSHConfigLookup(t *testing.T) {
+	home := writeSSHConfig(t, map[string]string{
+		"config": `
+User global
+Include conf.d/*.conf
+
+Host web
+  HostName web.example.com
+  Port 2200
+  IdentityFile ~/.ssh/web_key
+
+Host web *.internal
+  User deploy
+  Port 2300
+
+Host * !bastion
+  IdentityFile ~/.ssh/id_common
+
+Host bastion
+  HostName=bastion.example.com
+
+Host *.lan
+  HostName %h.example.com
+
+Host db
+  Include "db dir/extra.conf"
+
+# Match 之后到下一个 Host 之前的参数和 Include 都属于 Match 块
+Match host web
+  User matched
+  Include match.conf
+`,
+		"conf.d/10-app.conf": "Host app\n  HostName app.example.com\n  User app\n",
+		"conf.d/20-web.conf": "Host web\n  Port 2100\n",
+		"conf.d/README":      "Host readme\n  HostName readme.example.com\n",
+		"db dir/extra.conf":  "HostName db.example.com\nPort 5432\nHost api\n  HostName api.example.com\n",
+		"match.conf":         "Host matched\n  HostName matched.example.com\n",
+	})
+	key := func(name string) string { return filepath.Join(home, ".ssh", name) }
+
+	tests := []struct {
+		alias string
+		want  sshHostConfig
+	}{
+		// 每个参数取第一次出现的值：User 在文件开头，Port 在先被包含的 conf.d/20-web.conf 中
+		{"web", sshHostConfig{Alias: "web", HostName: "web.example.com", User: "global", Port: 2100,
+			IdentityFiles: []string{key("web_key"), key("id_common")}}},
+		{"x.internal", sshHostConfig{Alias: "x.internal", HostName: "x.internal", User: "global", Port: 2300,
+			IdentityFiles: []string{key("id_common")}}},
+		// !bastion 排除
+		{"bastion", sshHostConfig{Alias: "bastion", HostName: "bastion.example.com", User: "global", Port: 22}},
+		{"nas.lan", sshHostConfig{Alias: "nas.lan", HostName: "nas.lan.example.com", User: "global", Port: 22,
+			IdentityFiles: []string{key("id_common")}}},
+		// Include 通配符只展开匹配的文件
+		{"app", sshHostConfig{Alias: "app", HostName: "app.example.com", User: "global", Port: 22,
+			IdentityFiles: []string{key("id_common")}}},
+		{"readme", sshHostConfig{Alias: "readme", HostName: "readme", User: "global", Port: 22,
+			IdentityFiles: []string{key("id_common")}}},
+		// Host 块中的 Include 只对该块的主机生效，引号中的路径可以有空格
+		{"db", sshHostConfig{Alias: "db", HostName: "db.example.com", User: "global", Port: 5432,
+			IdentityFiles: []string{key("id_common")}}},
+		{"api", sshHostConfig{Alias: "api", HostName: "api", User: "global", Port: 22,
+			IdentityFiles: []string{key("id_common")}}},
+		// Match 块和其中的 Include 被跳过
+		{"matched", sshHostConfig{Alias: "matched", HostName: "matched", User: "global", Port: 22,
+			IdentityFiles: []string{key("id_common")}}},
+	}
+
+	c := loadSSHConfig()
+	for _, tt := range tests {
+		if got := c.lookup(tt.alias); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("lookup(%q) = %+v, want %+v", tt.alias, got, tt.want)
+		}
+	}
+
+	want := []string{"app", "web", "bastion", "db"}
+	if got := c.aliases(); !reflect.DeepEqual(got, want) {
+		t.Errorf("aliases() = %q, want %q", got, want)
+	}
+}
+
+func TestSSHConfigDefaults(t *testing.T) {
+	writeSSHConfig(t, nil)
+	want := sshHostConfig{Alias: "box", HostName: "box", User: "me", Port: 22}
+	if got := lookupSSHHost("box"); !reflect.DeepEqual(got, want) {
+		t.Errorf("lookupSSHHost without config = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/muesli/cancelreader"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// /shell：在已连接的主机上打开全屏 PTY shell（vim、htop 等交互程序），退出后回到对话界面
+//
+// 通过 tea.Exec 运行：期间 Bubble Tea 暂停并释放终端，shell 占用整个终端而不是对话界面中的一个区域；
+// shell 从远程 shell 的当前目录启动。
+// Exec 期间 Bubble Tea 不处理 WindowSizeMsg：打开时读取当前终端大小（读取失败时用最近的 WindowSizeMsg），
+// 之后的变化由 ptyShell 监听 SIGWINCH（Windows 上定期检查）并发送给远程。
+type ptyShell struct {
+	host   string
+	cwd    string
+	width  int // 初始大小，来自最近的 tea.WindowSizeMsg
+	height int
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func (p *ptyShell) SetStdin(r io.Reader)  { p.stdin = r }
+func (p *ptyShell) SetStdout(w io.Writer) { p.stdout = w }
+func (p *ptyShell) SetStderr(w io.Writer) { p.stderr = w }
+
+// 终端的文件描述符，不是终端时返回 -1
+func terminalFd(v interface{}) int {
+	if f, ok := v.(interface{ Fd() uintptr }); ok && term.IsTerminal(int(f.Fd())) {
+		return int(f.Fd())
+	}
+	return -1
+}
+
+func (p *ptyShell) Run() error {
+	session, err := sshSession(p.host)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	outFd := terminalFd(p.stdout)
+	if outFd >= 0 {
+		if w, h, err := term.GetSize(outFd); err == nil {
+			p.width, p.height = w, h
+		}
+	}
+	termType := os.Getenv("TERM")
+	if termType == "" {
+		termType = "xterm-256color"
+	}
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	if err := session.RequestPty(termType, p.height, p.width, modes); err != nil {
+		return fmt.Errorf("无法分配 PTY: %v", err)
+	}
+
+	// 本地终端进入 raw 模式，按键（包括 Ctrl+C）原样发送给远程
+	if fd := terminalFd(p.stdin); fd >= 0 {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer term.Restore(fd, state)
+	}
+
+	stdinPipe, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	// 结束后取消读取，否则遗留的 goroutine 会吃掉回到 TUI 后的第一个按键；
+	// 等它退出后再 Close，提前关闭会丢失取消信号
+	stdin, err := cancelreader.NewReader(p.stdin)
+	if err != nil {
+		return err
+	}
+	copied := make(chan struct{})
+	go func() {
+		io.Copy(stdinPipe, stdin)
+		close(copied)
+	}()
+	defer func() {
+		if stdin.Cancel() {
+			<-copied
+		}
+		stdin.Close()
+	}()
+	session.Stdout = p.stdout
+	session.Stderr = p.stderr
+
+	command := `exec "${SHELL:-/bin/sh}" -l`
+	if p.cwd != "" {
+		command = fmt.Sprintf("cd %s 2>/dev/null; %s", shellQuote(p.cwd), command)
+	}
+	if err := session.Start(command); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	if outFd >= 0 {
+		go watchPtySize(session, outFd, p.width, p.height, resizeEvents(done))
+	}
+
+	err = session.Wait()
+	// 远程 shell 正常退出（包括非 0 退出码）不算错误
+	if _, ok := err.(*ssh.ExitError); ok {
+		return nil
+	}
+	return err
+}
+
+// 终端大小可能变化时重新读取，有变化时通知远程；events 关闭时返回
+func watchPtySize(session *ssh.Session, fd, width, height int, events <-chan struct{}) {
+	for range events {
+		w, h, err := term.GetSize(fd)
+		if err != nil || (w == width && h == height) {
+			continue
+		}
+		width, height = w, h
+		session.WindowChange(h, w)
+	}
+}
+
+type ptyExitedMsg struct {
+	host string
+	err  error
+}
+
+func openPtyShell(host string, width, height int) tea.Cmd {
+	if width <= 0 || height <= 0 {
+		width, height = 80, 24
+	}
+	cwd := remoteCwd(host)
+	return tea.Exec(&ptyShell{host: host, cwd: cwd, width: width, height: height}, func(err error) tea.Msg {
+		return ptyExitedMsg{host: host, err: err}
+	})
+}
@@ -0,0 +1,28 @@
+package main
+
+import "time"
+
+// Windows 控制台没有 SIGWINCH，定期检查终端大小
+const ptyResizeInterval = 250 * time.Millisecond
+
+// 定期发送事件，done 关闭后停止并关闭返回的 channel
+func resizeEvents(done <-chan struct{}) <-chan struct{} {
+	events := make(chan struct{}, 1)
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(ptyResizeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				select {
+				case events <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return events
+}
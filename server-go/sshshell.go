@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"golang.org/x/crypto/ssh"
+)
+
+// SSH 模式下每个主机一个长期运行的远程登录 shell（$SHELL -l），cd、export 等在命令之间保持
+//
+// 每条命令通过 eval 在同一个 shell 中执行，标准输入为 /dev/null；输出按行实时返回。
+// 协议使用 POSIX 语法，$SHELL 不是 POSIX 兼容的 shell（fish 等）时使用 sh -l。
+// 执行后在标准输出写一行 "<marker> <退出码> <当前目录>"、在标准错误写一行 "<marker>"，
+// 用来确定两路输出的结束位置和更新提示符中的目录。
+// shell 退出（例如输入 exit）或连接断开后，下一条命令启动新的 shell 并回到原来的目录。
+type remoteShell struct {
+	mu      sync.Mutex
+	session *ssh.Session
+	stdin   io.WriteCloser
+	stdout  *bufio.Reader
+	stderr  *bufio.Reader
+	marker  string
+	pid     int    // 远程 shell 的进程号，中断时向它的进程组发送 SIGINT
+	home    string // 远程的 $HOME，提示符中显示为 ~
+	cwd     string
+}
+
+// 命令的超时时间（--ssh-timeout），0 表示不限制
+var sshCommandTimeout = 10 * time.Minute
+
+// 超时或中断后等待命令退出的时间，之后关闭 shell
+const sshKillDelay = 5 * time.Second
+
+// 正在启动的 shell，同一主机的其他调用者等待它完成
+type shellStart struct {
+	done  chan struct{}
+	shell *remoteShell
+	err   error
+}
+
+var remoteShells = struct {
+	sync.Mutex
+	shells   map[string]*remoteShell
+	starting map[string]*shellStart
+	cwds     map[string]string // 最后的目录，shell 重新启动时恢复
+}{shells: map[string]*remoteShell{}, starting: map[string]*shellStart{}, cwds: map[string]string{}}
+
+// 远程启动登录 shell 的命令。外层用 sh -c，用户的登录 shell 不是 POSIX shell 时也能解析
+const remoteShellCommand = `exec sh -c 'case "${SHELL##*/}" in bash|zsh|ksh|mksh|dash|ash|sh) exec "$SHELL" -l ;; *) exec sh -l ;; esac'`
+
+var errShellExited = errors.New("远程 shell 已退出")
+
+func startRemoteShell(host string) (*remoteShell, error) {
+	session, err := sshSession(host)
+	if err != nil {
+		return nil, err
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	stderr, err := session.StderrPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	if err := session.Start(remoteShellCommand); err != nil {
+		session.Close()
+		return nil, err
+	}
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	s := &remoteShell{
+		session: session,
+		stdin:   stdin,
+		stdout:  bufio.NewReader(stdout),
+		stderr:  bufio.NewReader(stderr),
+		marker:  "__cicy_done_" + hex.EncodeToString(id),
+	}
+	// 登录配置（motd、nvm 等）可能先输出内容，进程号和 $HOME 写在带标记的一行中。
+	// 中断时 SIGINT 发给整个进程组，shell 用 trap 忽略它（trap 的处理函数不会被子进程继承）
+	infoPrefix := s.marker + "_info "
+	info := ""
+	_, err = s.run(fmt.Sprintf(`trap : INT; printf '\n%s%%s %%s\n' "$$" "$HOME"`, infoPrefix), func(line string, stderr bool) {
+		if !stderr && strings.HasPrefix(line, infoPrefix) {
+			info = strings.TrimPrefix(line, infoPrefix)
+		}
+	})
+	if err == nil && info == "" {
+		err = errors.New("没有返回进程号")
+	}
+	if err != nil {
+		s.close()
+		return nil, fmt.Errorf("无法启动远程 shell: %v", err)
+	}
+	parts := strings.SplitN(info, " ", 2)
+	s.pid, _ = strconv.Atoi(parts[0])
+	if len(parts) == 2 {
+		s.home = parts[1]
+	}
+	return s, nil
+}
+
+// 单引号转义，eval 的参数原样传给 shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// 执行一条命令，每行输出调用一次 output（stderr 表示来自标准错误），返回退出码
+func (s *remoteShell) run(command string, output func(line string, stderr bool)) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	script := fmt.Sprintf("eval %s </dev/null\n__cicy_rc=$?; printf '\\n%s %%d %%s\\n' \"$__cicy_rc\" \"$PWD\"; printf '\\n%s\\n' >&2\n",
+		shellQuote(command), s.marker, s.marker)
+	if _, err := io.WriteString(s.stdin, script); err != nil {
+		return 0, errShellExited
+	}
+
+	stderrDone := make(chan error, 1)
+	go func() {
+		stderrDone <- s.readLines(s.stderr, func(line string) { output(line, true) })
+	}()
+
+	status := 0
+	err := s.readLines(s.stdout, func(line string) { output(line, false) }, func(fields string) {
+		parts := strings.SplitN(fields, " ", 2)
+		status, _ = strconv.Atoi(parts[0])
+		if len(parts) == 2 {
+			s.cwd = parts[1]
+		}
+	})
+	if stderrErr := <-stderrDone; err == nil {
+		err = stderrErr
+	}
+	return status, err
+}
+
+// 逐行读取直到标记行，done 收到标记之后的内容
+//
+// 标记行之前补了一个换行，没有换行结尾的输出也能完整返回；结尾的空行不输出
+func (s *remoteShell) readLines(r *bufio.Reader, emit func(string), done ...func(string)) error {
+	blank := 0
+	for {
+		line, err := r.ReadString('\n')
+		if line == s.marker+"\n" || strings.HasPrefix(line, s.marker+" ") {
+			for _, f := range done {
+				f(strings.TrimSuffix(strings.TrimPrefix(line[len(s.marker):], " "), "\n"))
+			}
+			return nil
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" && err == nil {
+			blank++
+			continue
+		}
+		for ; blank > 0; blank-- {
+			emit("")
+		}
+		if line != "" {
+			emit(line)
+		}
+		if err != nil {
+			return errShellExited
+		}
+	}
+}
+
+// 中断正在执行的命令：向 shell 的进程组发送 SIGINT，管道和子进程启动的进程也会收到（shell 本身用 trap 忽略）
+//
+// sshd 让 shell 成为会话首进程，进程组号就是它的进程号；不是时退回到只中断 shell 的直接子进程
+func (s *remoteShell) interrupt(host string) error {
+	session, err := sshSession(host)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	err = session.Run(fmt.Sprintf("kill -INT -%d 2>/dev/null || pkill -INT -P %d", s.pid, s.pid))
+	// 退出码 1：没有子进程（命令是 shell 内置命令），等待超时后关闭 shell
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitStatus() == 1 {
+		return nil
+	}
+	return err
+}
+
+// 提示符中显示的目录，$HOME 显示为 ~
+func (s *remoteShell) displayCwd() string {
+	if s.home != "" && s.home != "/" && (s.cwd == s.home || strings.HasPrefix(s.cwd, s.home+"/")) {
+		return "~" + s.cwd[len(s.home):]
+	}
+	return s.cwd
+}
+
+func (s *remoteShell) close() {
+	s.stdin.Close()
+	s.session.Close()
+}
+
+// 返回主机的 shell，没有时启动新的 shell 并回到上次的目录
+//
+// 启动 shell 需要网络往返，不持有 remoteShells 的锁，其他主机的命令和 remoteCwd 不会被阻塞
+func remoteShellFor(host string) (*remoteShell, error) {
+	remoteShells.Lock()
+	if s := remoteShells.shells[host]; s != nil {
+		remoteShells.Unlock()
+		return s, nil
+	}
+	if st := remoteShells.starting[host]; st != nil {
+		remoteShells.Unlock()
+		<-st.done
+		return st.shell, st.err
+	}
+	st := &shellStart{done: make(chan struct{})}
+	remoteShells.starting[host] = st
+	cwd := remoteShells.cwds[host]
+	remoteShells.Unlock()
+
+	s, err := startRemoteShellIn(host, cwd)
+
+	remoteShells.Lock()
+	if remoteShells.starting[host] != st {
+		// 启动期间主机被断开（/exit 或退出 TUI）
+		if err == nil {
+			s.close()
+			s, err = nil, errShellExited
+		}
+	} else {
+		delete(remoteShells.starting, host)
+		if err == nil {
+			remoteShells.shells[host] = s
+		}
+	}
+	remoteShells.Unlock()
+
+	st.shell, st.err = s, err
+	close(st.done)
+	return s, err
+}
+
+// 启动 shell 并回到 cwd（为空时只检查 shell 可用）
+func startRemoteShellIn(host, cwd string) (*remoteShell, error) {
+	s, err := startRemoteShell(host)
+	if err != nil {
+		return nil, err
+	}
+	discard := func(string, bool) {}
+	if cwd != "" {
+		if status, err := s.run("cd "+shellQuote(cwd), discard); err != nil || status != 0 {
+			log.Printf("⚠️  无法回到远程目录 %s: %s", cwd, host)
+		}
+	} else if _, err := s.run(":", discard); err != nil {
+		s.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// 远程 shell 的当前目录（完整路径），还没有执行过命令时为空
+func remoteCwd(host string) string {
+	remoteShells.Lock()
+	defer remoteShells.Unlock()
+	if s := remoteShells.shells[host]; s != nil {
+		return s.cwd
+	}
+	return remoteShells.cwds[host]
+}
+
+func closeRemoteShell(host string) {
+	remoteShells.Lock()
+	s := remoteShells.shells[host]
+	delete(remoteShells.shells, host)
+	delete(remoteShells.starting, host)
+	delete(remoteShells.cwds, host)
+	remoteShells.Unlock()
+	if s != nil {
+		s.close()
+	}
+}
+
+func closeAllRemoteShells() {
+	remoteShells.Lock()
+	shells := remoteShells.shells
+	remoteShells.shells = map[string]*remoteShell{}
+	remoteShells.starting = map[string]*shellStart{}
+	remoteShells.cwds = map[string]string{}
+	remoteShells.Unlock()
+	for _, s := range shells {
+		s.close()
+	}
+}
+
+type sshConnectedMsg struct {
+	host string
+	cwd  string
+	err  error
+}
+
+// 在后台建立连接并启动远程 shell，结果通过 sshConnectedMsg 返回
+func sshConnectCmd(host string) tea.Cmd {
+	return func() tea.Msg {
+		s, err := remoteShellFor(host)
+		if err != nil {
+			return sshConnectedMsg{host: host, err: err}
+		}
+		return sshConnectedMsg{host: host, cwd: s.displayCwd()}
+	}
+}
+
+// 远程命令输出的一行
+type sshOutputMsg struct {
+	line   string
+	stderr bool
+}
+
+// 远程命令结束；err 不为 nil 时（shell 退出、超时、被终止）status 无效
+type sshResultMsg struct {
+	status   int
+	err      error
+	cwd      string
+	duration time.Duration
+}
+
+var (
+	errSSHTimeout = errors.New("超时")
+	errSSHKilled  = errors.New("已终止")
+)
+
+// 正在执行命令的 shell，Ctrl+C 时中断它
+var runningShell = struct {
+	sync.Mutex
+	host   string
+	shell  *remoteShell
+	result chan struct{} // 命令结束时关闭
+	reason error         // 超时 / 终止
+}{}
+
+// 在远程 shell 中执行命令，输出逐行推送到 TUI；shell 已退出时下一条命令会启动新的 shell
+func executeSSHCommand(host, command string) sshResultMsg {
+	start := time.Now()
+	s, err := remoteShellFor(host)
+	if err != nil {
+		return sshResultMsg{err: err, duration: time.Since(start)}
+	}
+
+	runningShell.Lock()
+	runningShell.host, runningShell.shell, runningShell.reason = host, s, nil
+	runningShell.result = make(chan struct{})
+	finished := runningShell.result
+	runningShell.Unlock()
+
+	if sshCommandTimeout > 0 {
+		timer := time.AfterFunc(sshCommandTimeout, func() {
+			stopSSHCommand(finished, errSSHTimeout)
+		})
+		defer timer.Stop()
+	}
+
+	status, err := s.run(command, func(line string, stderr bool) {
+		if tuiProgram != nil {
+			tuiProgram.Send(sshOutputMsg{line: line, stderr: stderr})
+		}
+	})
+
+	runningShell.Lock()
+	close(finished)
+	reason := runningShell.reason
+	runningShell.host, runningShell.shell = "", nil
+	runningShell.Unlock()
+
+	// shell 已退出时丢弃它，下一条命令重新启动
+	if err != nil {
+		remoteShells.Lock()
+		if remoteShells.shells[host] == s {
+			delete(remoteShells.shells, host)
+		}
+		remoteShells.Unlock()
+		s.close()
+	}
+	remoteShells.Lock()
+	remoteShells.cwds[host] = s.cwd
+	remoteShells.Unlock()
+
+	// 超时总是报告；中断后命令自己退出时显示它的退出码
+	if reason == errSSHTimeout || (reason != nil && err != nil) {
+		err = reason
+	}
+	return sshResultMsg{status: status, err: err, cwd: s.displayCwd(), duration: time.Since(start)}
+}
+
+// 先中断命令，sshKillDelay 后仍未结束时关闭 shell
+func stopSSHCommand(finished chan struct{}, reason error) {
+	runningShell.Lock()
+	if runningShell.result != finished {
+		runningShell.Unlock()
+		return
+	}
+	host, s := runningShell.host, runningShell.shell
+	runningShell.reason = reason
+	runningShell.Unlock()
+
+	if err := s.interrupt(host); err != nil {
+		log.Printf("⚠️  中断远程命令失败: %v", err)
+	}
+	select {
+	case <-finished:
+	case <-time.After(sshKillDelay):
+		s.close()
+	}
+}
+
+// Ctrl+C：第一次中断命令，第二次直接关闭 shell
+func interruptSSHCommand(force bool) {
+	runningShell.Lock()
+	finished, s := runningShell.result, runningShell.shell
+	if s == nil {
+		runningShell.Unlock()
+		return
+	}
+	runningShell.reason = errSSHKilled
+	runningShell.Unlock()
+
+	if force {
+		s.close()
+		return
+	}
+	go stopSSHCommand(finished, errSSHKilled)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+)
+
+// stdio 传输：每行一个 JSON-RPC 消息（MCP 宿主以子进程方式启动时使用）
+type stdioTransport struct {
+	in  io.Reader
+	out io.Writer
+	mu  sync.Mutex // 保护 out，避免响应交错
+}
+
+func newStdioTransport(in io.Reader, out io.Writer) *stdioTransport {
+	return &stdioTransport{in: in, out: out}
+}
+
+// 写出一条消息（自动追加换行）
+func (t *stdioTransport) write(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err = t.out.Write(append(data, '\n'))
+	return err
+}
+
+func (t *stdioTransport) notify(method string, params interface{}) {
+	if err := t.write(JSONRPCNotification{JSONRPC: "2.0", Method: method, Params: params}); err != nil {
+		log.Printf("❌ stdio 通知发送失败: %v", err)
+	}
+}
+
+// 读取请求直到 stdin 关闭
+func (t *stdioTransport) serve() error {
+	scanner := bufio.NewScanner(t.in)
+	// 图片等 base64 内容可能很长
+	scanner.Buffer(make([]byte, 64*1024), 32*1024*1024)
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var req JSONRPCRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			if err := t.write(newRPCError(nil, -32700, "Parse error")); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if resp := handleRPC(withNotifier(context.Background(), t), req); resp != nil {
+			if err := t.write(resp); err != nil {
+				return err
+			}
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errMessageNotFound = errors.New("message not found")
+
+// 消息存储接口
+type Store interface {
+	// 追加消息，由存储分配全局单调递增的 ID（清空后也不会重复）
+	Append(msg Message) (Message, error)
+	// 按 ID 升序返回所有消息
+	List() ([]Message, error)
+	// 按 ID 升序返回符合条件的消息，最多 q.Limit 条
+	Find(q MessageQuery) ([]Message, error)
+	Get(id int) (Message, error)
+	Delete(id int) error
+	// 删除所有消息，返回被删除的消息（用于清理附件文件）
+	Clear() ([]Message, error)
+	// 从最旧的消息开始删除，直到不超过 maxCount 条、maxSize 字节（0 表示不限制），
+	// 至少保留最新的一条；返回被删除的消息
+	Trim(maxCount int, maxSize int64) ([]Message, error)
+	Close() error
+}
+
+// 消息查询条件，零值表示不限制
+type MessageQuery struct {
+	AfterID int       // 只返回 ID 大于它的消息（游标）
+	Type    string    // "text" / "image" / "attachment"
+	Query   string    // 文本或图片名称的子串
+	Since   time.Time // 时间下限（含）
+	Until   time.Time // 时间上限（不含）
+	Limit   int
+}
+
+func (q MessageQuery) match(msg Message) bool {
+	if msg.ID <= q.AfterID {
+		return false
+	}
+	if q.Type != "" && msg.Type != q.Type {
+		return false
+	}
+	if q.Query != "" && !strings.Contains(msg.Text, q.Query) && !strings.Contains(msg.Name, q.Query) {
+		return false
+	}
+	if !q.Since.IsZero() && msg.Timestamp.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !msg.Timestamp.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+// 全局消息存储
+var store Store = newMemoryStore()
+
+// 根据 --store 参数打开存储
+func openStore(kind, path string) (Store, error) {
+	switch kind {
+	case "", "memory":
+		return newMemoryStore(), nil
+	case "bolt":
+		return newBoltStore(path)
+	default:
+		return nil, fmt.Errorf("未知的存储类型: %s (可选: memory, bolt)", kind)
+	}
+}
+
+// 内存存储（重启后丢失）
+type memoryStore struct {
+	mu       sync.RWMutex
+	messages []Message
+	seq      int   // 最后分配的 ID
+	size     int64 // 所有消息的 messageBytes 之和
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{}
+}
+
+func (s *memoryStore) Append(msg Message) (Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	msg.ID = s.seq
+	s.messages = append(s.messages, msg)
+	s.size += messageBytes(msg)
+	return msg, nil
+}
+
+func (s *memoryStore) List() ([]Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Message{}, s.messages...), nil
+}
+
+func (s *memoryStore) Find(q MessageQuery) ([]Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// messages 按 ID 升序，二分查找起点
+	start := sort.Search(len(s.messages), func(i int) bool {
+		return s.messages[i].ID > q.AfterID
+	})
+
+	list := []Message{}
+	for _, msg := range s.messages[start:] {
+		if !q.match(msg) {
+			continue
+		}
+		list = append(list, msg)
+		if q.Limit > 0 && len(list) >= q.Limit {
+			break
+		}
+	}
+	return list, nil
+}
+
+func (s *memoryStore) Get(id int) (Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, msg := range s.messages {
+		if msg.ID == id {
+			return msg, nil
+		}
+	}
+	return Message{}, errMessageNotFound
+}
+
+func (s *memoryStore) Delete(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, msg := range s.messages {
+		if msg.ID == id {
+			s.messages = append(s.messages[:i], s.messages[i+1:]...)
+			s.size -= messageBytes(msg)
+			return nil
+		}
+	}
+	return errMessageNotFound
+}
+
+func (s *memoryStore) Clear() ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cleared := s.messages
+	s.messages, s.size = nil, 0
+	return cleared, nil
+}
+
+func (s *memoryStore) Trim(maxCount int, maxSize int64) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for len(s.messages)-n > 1 && overLimit(len(s.messages)-n, s.size, maxCount, maxSize) {
+		s.size -= messageBytes(s.messages[n])
+		n++
+	}
+	trimmed := append([]Message{}, s.messages[:n]...)
+	s.messages = append([]Message{}, s.messages[n:]...)
+	return trimmed, nil
+}
+
+// 消息数或总字节数是否超出上限（0 表示不限制）
+func overLimit(count int, size int64, maxCount int, maxSize int64) bool {
+	return (maxCount > 0 && count > maxCount) || (maxSize > 0 && size > maxSize)
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
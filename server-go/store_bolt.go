@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	messagesBucket = []byte("messages")
+	// 单独保存 ID 序列，清空 messages 时不会重置
+	sequenceBucket = []byte("sequence")
+)
+
+// 基于 bbolt 的持久化存储，重启后历史仍然保留
+type boltStore struct {
+	db *bolt.DB
+
+	// 写操作串行执行，count / size 与数据库一致，Trim 不需要遍历所有消息
+	mu    sync.Mutex
+	count int
+	size  int64 // 所有消息的 messageBytes 之和
+}
+
+func newBoltStore(path string) (*boltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(messagesBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(sequenceBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &boltStore{db: db}
+	err = db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(messagesBucket).ForEach(func(k, v []byte) error {
+			var msg Message
+			if err := json.Unmarshal(v, &msg); err != nil {
+				return err
+			}
+			s.count++
+			s.size += messageBytes(msg)
+			return nil
+		})
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// ID 按大端序编码，保证按 key 遍历即按 ID 升序
+func idKey(id int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(id))
+	return key
+}
+
+func (s *boltStore) Append(msg Message) (Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(messagesBucket)
+		seq := tx.Bucket(sequenceBucket)
+
+		next, err := seq.NextSequence()
+		if err != nil {
+			return err
+		}
+		// 旧版本数据库没有序列，从已有的最大 ID 继续
+		if last, _ := b.Cursor().Last(); last != nil {
+			if lastID := binary.BigEndian.Uint64(last); next <= lastID {
+				next = lastID + 1
+				if err := seq.SetSequence(next); err != nil {
+					return err
+				}
+			}
+		}
+		msg.ID = int(next)
+
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		return b.Put(idKey(msg.ID), data)
+	})
+	if err == nil {
+		s.count++
+		s.size += messageBytes(msg)
+	}
+	return msg, err
+}
+
+func (s *boltStore) List() ([]Message, error) {
+	return s.Find(MessageQuery{})
+}
+
+func (s *boltStore) Find(q MessageQuery) ([]Message, error) {
+	if q.AfterID < 0 {
+		q.AfterID = 0
+	}
+
+	list := []Message{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(messagesBucket).Cursor()
+		for k, v := c.Seek(idKey(q.AfterID + 1)); k != nil; k, v = c.Next() {
+			var msg Message
+			if err := json.Unmarshal(v, &msg); err != nil {
+				return err
+			}
+			if !q.match(msg) {
+				continue
+			}
+			list = append(list, msg)
+			if q.Limit > 0 && len(list) >= q.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	return list, err
+}
+
+func (s *boltStore) Get(id int) (Message, error) {
+	var msg Message
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(messagesBucket).Get(idKey(id))
+		if v == nil {
+			return errMessageNotFound
+		}
+		return json.Unmarshal(v, &msg)
+	})
+	return msg, err
+}
+
+func (s *boltStore) Delete(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var msg Message
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(messagesBucket)
+		v := b.Get(idKey(id))
+		if v == nil {
+			return errMessageNotFound
+		}
+		if err := json.Unmarshal(v, &msg); err != nil {
+			return err
+		}
+		return b.Delete(idKey(id))
+	})
+	if err == nil {
+		s.count--
+		s.size -= messageBytes(msg)
+	}
+	return err
+}
+
+func (s *boltStore) Clear() ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var cleared []Message
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(messagesBucket).ForEach(func(k, v []byte) error {
+			var msg Message
+			if err := json.Unmarshal(v, &msg); err != nil {
+				return err
+			}
+			cleared = append(cleared, msg)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if err := tx.DeleteBucket(messagesBucket); err != nil {
+			return err
+		}
+		_, err = tx.CreateBucket(messagesBucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.count, s.size = 0, 0
+	return cleared, nil
+}
+
+func (s *boltStore) Trim(maxCount int, maxSize int64) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.count <= 1 || !overLimit(s.count, s.size, maxCount, maxSize) {
+		return nil, nil
+	}
+	var trimmed []Message
+	count, size := s.count, s.size
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(messagesBucket)
+		// 先收集再删除，遍历时删除会让游标跳过下一条
+		c := b.Cursor()
+		for k, v := c.First(); k != nil && count > 1 && overLimit(count, size, maxCount, maxSize); k, v = c.Next() {
+			var msg Message
+			if err := json.Unmarshal(v, &msg); err != nil {
+				return err
+			}
+			trimmed = append(trimmed, msg)
+			count--
+			size -= messageBytes(msg)
+		}
+		for _, msg := range trimmed {
+			if err := b.Delete(idKey(msg.ID)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.count, s.size = count, size
+	return trimmed, nil
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
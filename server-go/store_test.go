@@ -0,0 +1,114 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func testStores(t *testing.T) map[string]func() Store {
+	return map[string]func() Store{
+		"memory": func() Store { return newMemoryStore() },
+		"bolt": func() Store {
+			s, err := newBoltStore(filepath.Join(t.TempDir(), "messages.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { s.Close() })
+			return s
+		},
+	}
+}
+
+func messageIDs(messages []Message) []int {
+	ids := []int{}
+	for _, msg := range messages {
+		ids = append(ids, msg.ID)
+	}
+	return ids
+}
+
+func TestStoreTrim(t *testing.T) {
+	for name, open := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			s := open()
+			for _, text := range []string{"aaaa", "bb", "cccc", "d"} {
+				if _, err := s.Append(Message{Type: "text", Text: text}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			tests := []struct {
+				maxCount int
+				maxSize  int64
+				trimmed  []int
+				left     []int
+			}{
+				{0, 0, []int{}, []int{1, 2, 3, 4}},
+				{4, 11, []int{}, []int{1, 2, 3, 4}},
+				{3, 0, []int{1}, []int{2, 3, 4}},
+				{0, 5, []int{2}, []int{3, 4}},
+				{1, 0, []int{3}, []int{4}},
+				{0, 0, []int{}, []int{4}},
+			}
+			for _, tt := range tests {
+				trimmed, err := s.Trim(tt.maxCount, tt.maxSize)
+				if err != nil {
+					t.Fatal(err)
+				}
+				left, _ := s.List()
+				if got := messageIDs(trimmed); !reflect.DeepEqual(got, tt.trimmed) {
+					t.Errorf("Trim(%d, %d) = %v, want %v", tt.maxCount, tt.maxSize, got, tt.trimmed)
+				}
+				if got := messageIDs(left); !reflect.DeepEqual(got, tt.left) {
+					t.Errorf("after Trim(%d, %d): %v, want %v", tt.maxCount, tt.maxSize, got, tt.left)
+				}
+			}
+
+			// 至少保留最新的一条
+			if trimmed, _ := s.Trim(0, 1); len(trimmed) != 0 {
+				t.Errorf("Trim removed the last message: %v", messageIDs(trimmed))
+			}
+
+			// 删除后的大小也计入
+			s.Append(Message{Type: "text", Text: "eeeeee"})
+			if err := s.Delete(4); err != nil {
+				t.Fatal(err)
+			}
+			if trimmed, _ := s.Trim(0, 6); len(trimmed) != 0 {
+				t.Errorf("Trim after Delete = %v, want none", messageIDs(trimmed))
+			}
+		})
+	}
+}
+
+func TestStoreClear(t *testing.T) {
+	for name, open := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			s := open()
+			s.Append(Message{Type: "text", Text: "a"})
+			s.Append(Message{Type: "text", Text: "b"})
+
+			cleared, err := s.Clear()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := messageIDs(cleared); !reflect.DeepEqual(got, []int{1, 2}) {
+				t.Errorf("Clear() = %v, want [1 2]", got)
+			}
+			if left, _ := s.List(); len(left) != 0 {
+				t.Errorf("after Clear: %v", messageIDs(left))
+			}
+
+			// 清空后 ID 不重复，大小从 0 开始计算
+			msg, _ := s.Append(Message{Type: "text", Text: "cc"})
+			if msg.ID != 3 {
+				t.Errorf("ID after Clear = %d, want 3", msg.ID)
+			}
+			s.Append(Message{Type: "text", Text: "dd"})
+			if trimmed, _ := s.Trim(0, 4); len(trimmed) != 0 {
+				t.Errorf("Trim after Clear = %v, want none", messageIDs(trimmed))
+			}
+		})
+	}
+}
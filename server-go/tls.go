@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// TLS：--tls-cert / --tls-key 使用已有证书，--tls-self-signed 在数据目录生成自签名证书
+//
+// --tls-client-ca 开启双向 TLS：客户端证书由该 CA 签发时，
+// 可以代替 bearer token（CN 需要用 token add --cert-cn 登记，见 certClient）。
+//
+// 客户端（send / tail / tui）用 --tls-ca 固定信任的 CA，--tls-client-cert / --tls-client-key 出示客户端证书。
+
+// 服务器的 TLS 配置，nil 表示使用明文 HTTP
+var serverTLS *tls.Config
+
+// 自签名证书的有效期
+const selfSignedValidity = 365 * 24 * time.Hour
+
+func tlsEnabled(c *config) bool {
+	return c.get("tls-cert") != "" || c.boolValue("tls-self-signed")
+}
+
+func selfSignedPaths() (string, string) {
+	dir := filepath.Join(appConfig.get("data-dir"), "tls")
+	return filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+}
+
+// 根据配置创建服务器的 TLS 配置
+func setupServerTLS() error {
+	if !tlsEnabled(appConfig) {
+		if appConfig.get("tls-client-ca") != "" {
+			return errors.New("--tls-client-ca 需要同时开启 TLS (--tls-cert 或 --tls-self-signed)")
+		}
+		return nil
+	}
+
+	certFile, keyFile := appConfig.get("tls-cert"), appConfig.get("tls-key")
+	if certFile == "" {
+		certFile, keyFile = selfSignedPaths()
+		if err := ensureSelfSignedCert(certFile, keyFile); err != nil {
+			return fmt.Errorf("无法生成自签名证书: %v", err)
+		}
+	} else if keyFile == "" {
+		return errors.New("--tls-cert 需要同时指定 --tls-key")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("无法加载证书: %v", err)
+	}
+	serverTLS = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	log.Printf("🔐 TLS 证书: %s (SHA-256 %s)", certFile, certFingerprint(cert.Certificate[0]))
+
+	if caFile := appConfig.get("tls-client-ca"); caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return err
+		}
+		// 没有客户端证书时仍然可以使用 token
+		serverTLS.ClientCAs = pool
+		serverTLS.ClientAuth = tls.VerifyClientCertIfGiven
+		log.Printf("🔐 接受 %s 签发的客户端证书", caFile)
+	}
+
+	// 同一进程中的 TUI 通过 localhost 访问服务器，只信任服务器自己的证书
+	pinServerCert(cert.Certificate[0])
+	return nil
+}
+
+func certFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// 证书不存在或已过期时生成新的自签名证书（ECDSA P-256，同时作为 CA，客户端可以用 --tls-ca 固定）
+func ensureSelfSignedCert(certFile, keyFile string) error {
+	if data, err := os.ReadFile(certFile); err == nil {
+		if block, _ := pem.Decode(data); block != nil {
+			if cert, err := x509.ParseCertificate(block.Bytes); err == nil && time.Now().Before(cert.NotAfter) {
+				return nil
+			}
+		}
+		log.Printf("⚠️  自签名证书无效或已过期，重新生成: %s", certFile)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	dnsNames, ips := certHosts()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "cicy-go", Organization: []string{"cicy"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              dnsNames,
+		IPAddresses:           ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(certFile), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return err
+	}
+	log.Printf("🔐 已生成自签名证书: %s (%s)", certFile, strings.Join(append(dnsNames, ipStrings(ips)...), ", "))
+	return nil
+}
+
+// 证书包含 localhost、本机名和所有网卡地址
+func certHosts() ([]string, []net.IP) {
+	dnsNames := []string{"localhost"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" && hostname != "localhost" {
+		dnsNames = append(dnsNames, hostname)
+	}
+	ips := []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && !ipNet.IP.IsLinkLocalUnicast() {
+				ips = append(ips, ipNet.IP)
+			}
+		}
+	}
+	return dnsNames, ips
+}
+
+func ipStrings(ips []net.IP) []string {
+	var s []string
+	for _, ip := range ips {
+		s = append(s, ip.String())
+	}
+	return s
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取 CA 证书: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s 中没有 PEM 格式的证书", file)
+	}
+	return pool, nil
+}
+
+// 通过客户端证书认证：只接受用 `token add --cert-cn` 登记过 CN 的证书，使用对应客户端的权限；
+// 未登记或已撤销的 CN 返回 nil
+func certClient(r *http.Request) *apiClient {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil
+	}
+	cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	if cn == "" {
+		return nil
+	}
+	return (&tokensFile{Tokens: loadClients()}).findCert(cn)
+}
+
+// 客户端命令（send / tail / tui 连接服务器）使用的 HTTP client
+var httpClient = http.DefaultClient
+
+// 根据 tls-ca / tls-client-cert / tls-client-key 配置客户端
+//
+// 指定 tls-ca 时只信任该 CA；服务器使用 --tls-self-signed 时默认信任数据目录中的自签名证书
+func setupClientTLS() error {
+	caFile := appConfig.get("tls-ca")
+	if caFile == "" && appConfig.boolValue("tls-self-signed") && appConfig.get("tls-cert") == "" {
+		if certFile, _ := selfSignedPaths(); fileExists(certFile) {
+			caFile = certFile
+		}
+	}
+	certFile, keyFile := appConfig.get("tls-client-cert"), appConfig.get("tls-client-key")
+	if caFile == "" && certFile == "" {
+		return nil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return err
+		}
+		config.RootCAs = pool
+	}
+	if certFile != "" {
+		if keyFile == "" {
+			return errors.New("--tls-client-cert 需要同时指定 --tls-client-key")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("无法加载客户端证书: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	setClientTLS(config)
+	return nil
+}
+
+// 进程内的 TUI 连接自己的服务器：证书必须与服务器证书完全相同，不检查主机名
+//
+// 在 setupClientTLS 的配置上修改，保留客户端证书（服务器开启双向 TLS 时仍然可以用证书认证）
+func pinServerCert(der []byte) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if clientTLS != nil {
+		config = clientTLS.Clone()
+	}
+	config.RootCAs = nil
+	config.InsecureSkipVerify = true
+	config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 || !bytes.Equal(rawCerts[0], der) {
+			return errors.New("服务器证书与本进程的证书不一致")
+		}
+		return nil
+	}
+	setClientTLS(config)
+}
+
+// 当前客户端的 TLS 配置，nil 表示使用默认配置
+var clientTLS *tls.Config
+
+func setClientTLS(config *tls.Config) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	httpClient = &http.Client{Transport: transport}
+	clientTLS = config
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func requestWithCert(cn string) *http.Request {
+	r := httptest.NewRequest("GET", "/messages", nil)
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	return r
+}
+
+// 只有用 --cert-cn 登记过的 CN 可以认证，与客户端同名的 CN 不能得到它的权限
+func TestCertClient(t *testing.T) {
+	newTestServer(t)
+
+	f, _ := readTokensFile()
+	if _, err := f.add("ops", []string{scopeAdmin}); err != nil {
+		t.Fatal(err)
+	}
+	f.find("ops").CertCN = "ops.example.com"
+	if err := writeTokensFile(f); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		cn   string
+		want string
+	}{
+		{"ops.example.com", "ops"},
+		{"ops", ""},
+		{"messages-read", ""},
+		{"unknown", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if c := certClient(requestWithCert(tt.cn)); c != nil {
+			got = c.Name
+		}
+		if got != tt.want {
+			t.Errorf("certClient(%q) = %q, want %q", tt.cn, got, tt.want)
+		}
+	}
+	if c := certClient(httptest.NewRequest("GET", "/messages", nil)); c != nil {
+		t.Errorf("certClient without TLS = %s, want nil", c.Name)
+	}
+
+	// 撤销后证书不再有效
+	f.revoke("ops")
+	if err := writeTokensFile(f); err != nil {
+		t.Fatal(err)
+	}
+	clients.Lock()
+	clients.modTime = clients.modTime.Add(-1) // 同一时间戳内写两次时强制重新加载
+	clients.Unlock()
+	if c := certClient(requestWithCert("ops.example.com")); c != nil {
+		t.Errorf("certClient after revoke = %s, want nil", c.Name)
+	}
+}
+
+// 固定服务器证书时保留客户端证书
+func TestPinServerCertKeepsClientCert(t *testing.T) {
+	savedClient, savedTLS := httpClient, clientTLS
+	t.Cleanup(func() { httpClient, clientTLS = savedClient, savedTLS })
+
+	cert := tls.Certificate{Certificate: [][]byte{{1, 2, 3}}}
+	setClientTLS(&tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{cert}})
+	pinServerCert([]byte{4, 5, 6})
+
+	config := httpClient.Transport.(*http.Transport).TLSClientConfig
+	if len(config.Certificates) != 1 {
+		t.Errorf("Certificates = %d, want 1", len(config.Certificates))
+	}
+	if config.VerifyPeerCertificate([][]byte{{4, 5, 6}}, nil) != nil {
+		t.Error("pinned certificate rejected")
+	}
+	if config.VerifyPeerCertificate([][]byte{{7}}, nil) == nil {
+		t.Error("other certificate accepted")
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 多客户端 token：每个客户端有名字和权限，保存在 tokens 文件（--tokens-file，默认 ~/data/cicy-tokens.json）
+//
+// 文件中只保存 token 的 SHA-256，明文只在 `cicy-go token add` 时输出一次。
+// token 文件（token-file）中的 token 是名为 default 的管理员 token。
+// 服务器每次认证时检查文件修改时间，add / revoke 无需重启即可生效。
+const (
+	scopeMessagesRead  = "messages:read"
+	scopeMessagesWrite = "messages:write"
+	scopeImagesWrite   = "images:write" // 图片和附件
+	scopeAdmin         = "admin"        // 包含所有权限，可以删除 / 清空消息
+)
+
+var allScopes = []string{scopeMessagesRead, scopeMessagesWrite, scopeImagesWrite, scopeAdmin}
+
+// token add 未指定 --scopes 时的权限
+const defaultScopes = scopeMessagesRead + "," + scopeMessagesWrite
+
+const defaultClientName = "default"
+
+var clientNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+type apiClient struct {
+	Name    string    `json:"name"`
+	Hash    string    `json:"hash"` // token 的 SHA-256（hex）
+	Scopes  []string  `json:"scopes"`
+	Created time.Time `json:"created"`
+	CertCN  string    `json:"cert_cn,omitempty"` // 可以用 CN 为该值的客户端证书代替 token
+}
+
+func (c *apiClient) hasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope || s == scopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+type tokensFile struct {
+	Tokens []*apiClient `json:"tokens"`
+}
+
+func tokensFilePath() string {
+	return appConfig.get("tokens-file")
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func parseScopes(value string) ([]string, error) {
+	var scopes []string
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		valid := false
+		for _, known := range allScopes {
+			if s == known {
+				valid = true
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("未知的权限: %s (可选: %s)", s, strings.Join(allScopes, ", "))
+		}
+		scopes = append(scopes, s)
+	}
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("至少需要一个权限")
+	}
+	return scopes, nil
+}
+
+func readTokensFile() (*tokensFile, error) {
+	f := &tokensFile{}
+	data, err := os.ReadFile(tokensFilePath())
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %v", tokensFilePath(), err)
+	}
+	return f, nil
+}
+
+func writeTokensFile(f *tokensFile) error {
+	path := tokensFilePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, _ := json.MarshalIndent(f, "", "  ")
+	// 先写临时文件再改名，服务器不会读到写了一半的文件
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (f *tokensFile) find(name string) *apiClient {
+	for _, c := range f.Tokens {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// 按客户端证书的 CN 查找
+func (f *tokensFile) findCert(cn string) *apiClient {
+	for _, c := range f.Tokens {
+		if c.CertCN != "" && c.CertCN == cn {
+			return c
+		}
+	}
+	return nil
+}
+
+// 添加客户端，返回明文 token
+func (f *tokensFile) add(name string, scopes []string) (string, error) {
+	if !clientNamePattern.MatchString(name) {
+		return "", fmt.Errorf("名字只能包含字母、数字、. _ -: %q", name)
+	}
+	if name == defaultClientName {
+		return "", fmt.Errorf("%s 是 token 文件中 token 的保留名字", defaultClientName)
+	}
+	if f.find(name) != nil {
+		return "", fmt.Errorf("客户端 %s 已存在", name)
+	}
+	token := generateToken()
+	f.Tokens = append(f.Tokens, &apiClient{
+		Name:    name,
+		Hash:    hashToken(token),
+		Scopes:  scopes,
+		Created: time.Now().UTC().Truncate(time.Second),
+	})
+	return token, nil
+}
+
+func (f *tokensFile) revoke(name string) bool {
+	for i, c := range f.Tokens {
+		if c.Name == name {
+			f.Tokens = append(f.Tokens[:i], f.Tokens[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// 服务器端的客户端列表，tokens 文件变化时重新加载
+var clients = struct {
+	sync.Mutex
+	modTime time.Time
+	list    []*apiClient
+}{}
+
+func loadClients() []*apiClient {
+	clients.Lock()
+	defer clients.Unlock()
+
+	info, err := os.Stat(tokensFilePath())
+	if err != nil {
+		clients.list, clients.modTime = nil, time.Time{}
+		return nil
+	}
+	if info.ModTime().Equal(clients.modTime) {
+		return clients.list
+	}
+
+	f, err := readTokensFile()
+	if err != nil {
+		// 保留上次成功加载的列表
+		log.Printf("⚠️  %v", err)
+		return clients.list
+	}
+	clients.list, clients.modTime = f.Tokens, info.ModTime()
+	log.Printf("🔑 已加载 %d 个客户端 token: %s", len(f.Tokens), tokensFilePath())
+	return clients.list
+}
+
+// 按 token 查找客户端：token 文件中的 token 是 default 管理员，其他在 tokens 文件中查找
+// 所有比较都是常量时间
+func lookupClient(token string) *apiClient {
+	if token == "" {
+		return nil
+	}
+	if authToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(authToken)) == 1 {
+		return &apiClient{Name: defaultClientName, Scopes: []string{scopeAdmin}}
+	}
+	hash := []byte(hashToken(token))
+	var found *apiClient
+	for _, c := range loadClients() {
+		if subtle.ConstantTimeCompare(hash, []byte(c.Hash)) == 1 {
+			found = c
+		}
+	}
+	return found
+}
+
+type clientKey struct{}
+
+func withClient(ctx context.Context, c *apiClient) context.Context {
+	if c == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, clientKey{}, c)
+}
+
+// 当前请求的客户端；stdio、进程内 TUI 和公开路径上没有 token 的请求返回 nil
+func clientFromContext(ctx context.Context) *apiClient {
+	c, _ := ctx.Value(clientKey{}).(*apiClient)
+	return c
+}
+
+// 消息的发送者名字
+func senderFromContext(ctx context.Context) string {
+	if c := clientFromContext(ctx); c != nil {
+		return c.Name
+	}
+	return ""
+}
+
+// 检查当前客户端的权限，没有客户端（本地 / 公开路径）时不限制
+func requireScope(ctx context.Context, scope string) error {
+	c := clientFromContext(ctx)
+	if scope == "" || c == nil || c.hasScope(scope) {
+		return nil
+	}
+	return newAPIError(http.StatusForbidden, "token %q lacks scope %s", c.Name, scope)
+}
+
+// HTTP 路由需要的权限；/mcp POST 按方法在 handleRPC 中检查，/api/message 按内容类型检查
+func routeScope(r *http.Request) string {
+	switch {
+	case r.URL.Path == "/messages", r.URL.Path == "/ws",
+		r.URL.Path == "/mcp" && r.Method == http.MethodGet,
+		strings.HasPrefix(r.URL.Path, "/api/images/"),
+		strings.HasPrefix(r.URL.Path, "/api/attachments/"):
+		return scopeMessagesRead
+	case r.URL.Path == "/message":
+		return scopeMessagesWrite
+	}
+	return ""
+}
+
+// MCP 方法需要的权限，未列出的方法（initialize、tools/list 等）只需要有效 token
+// prompts 模板通过 {{today}}、{{messages N}} 等读取消息记录，与 resources 相同需要 messages:read
+var methodScopes = map[string]string{
+	"resources/list":        scopeMessagesRead,
+	"resources/read":        scopeMessagesRead,
+	"resources/subscribe":   scopeMessagesRead,
+	"resources/unsubscribe": scopeMessagesRead,
+	"prompts/list":          scopeMessagesRead,
+	"prompts/get":           scopeMessagesRead,
+}
+
+var toolScopes = map[string]string{
+	"send_message":   scopeMessagesWrite,
+	"get_messages":   scopeMessagesRead,
+	"clear_messages": scopeAdmin,
+}
+
+func rpcScope(req JSONRPCRequest) string {
+	if req.Method == "tools/call" {
+		name, _ := req.Params["name"].(string)
+		return toolScopes[name]
+	}
+	return methodScopes[req.Method]
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testAdminToken = "test-admin-token"
+
+// 用临时目录中的 token 文件和内存存储启动测试服务器，返回每个权限对应的 token
+func newTestServer(t *testing.T) (*httptest.Server, map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+
+	savedConfig, savedStore, savedToken := appConfig, store, authToken
+	savedDataDir, savedPrompts, savedRate := dataDir, promptsDir, rateLimit
+	t.Cleanup(func() {
+		appConfig, store, authToken = savedConfig, savedStore, savedToken
+		dataDir, promptsDir, rateLimit = savedDataDir, savedPrompts, savedRate
+		closeAllSessions()
+	})
+
+	appConfig = defaultConfig()
+	appConfig.set("tokens-file", filepath.Join(dir, "tokens.json"), "test")
+	store = newMemoryStore()
+	authToken = testAdminToken
+	dataDir = dir
+	promptsDir = ""
+	rateLimit = 0
+
+	f := &tokensFile{}
+	tokens := map[string]string{scopeAdmin: testAdminToken}
+	for _, scope := range []string{scopeMessagesRead, scopeMessagesWrite, scopeImagesWrite} {
+		token, err := f.add(strings.ReplaceAll(scope, ":", "-"), []string{scope})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens[scope] = token
+	}
+	if err := writeTokensFile(f); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(serverHandler())
+	t.Cleanup(server.Close)
+	return server, tokens
+}
+
+// 1x1 PNG
+const testPNG = "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNkYPhfDwAChwGA60e6kgAAAABJRU5ErkJggg=="
+
+type scopeCase struct {
+	name   string
+	method string
+	path   string
+	body   string
+	scope  string // 需要的权限，空表示任何有效 token
+}
+
+var routeScopeCases = []scopeCase{
+	{"GET /messages", "GET", "/messages", "", scopeMessagesRead},
+	{"GET /mcp stream", "GET", "/mcp", "", scopeMessagesRead},
+	{"GET /ws", "GET", "/ws", "", scopeMessagesRead},
+	{"GET image", "GET", "/api/images/1", "", scopeMessagesRead},
+	{"GET attachment", "GET", "/api/attachments/1/raw", "", scopeMessagesRead},
+	{"POST /message", "POST", "/message", `{"message":"hi"}`, scopeMessagesWrite},
+	{"POST text", "POST", "/api/message", `{"type":"text","text":"hi"}`, scopeMessagesWrite},
+	{"POST text content", "POST", "/api/message", `{"content":[{"type":"text","text":"hi"}]}`, scopeMessagesWrite},
+	{"POST image", "POST", "/api/message", `{"type":"image","data":"` + testPNG + `"}`, scopeImagesWrite},
+	{"POST attachment", "POST", "/api/message", `{"content":[{"type":"attachment","name":"a.txt","data":"aGk="}]}`, scopeImagesWrite},
+}
+
+func rpcBody(method string, params string) string {
+	return fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":%q,"params":%s}`, method, params)
+}
+
+func toolCall(name, args string) string {
+	return rpcBody("tools/call", fmt.Sprintf(`{"name":%q,"arguments":%s}`, name, args))
+}
+
+var rpcScopeCases = []scopeCase{
+	{"initialize", "POST", "/mcp", rpcBody("initialize", `{}`), ""},
+	{"tools/list", "POST", "/mcp", rpcBody("tools/list", `{}`), ""},
+	{"resources/templates/list", "POST", "/mcp", rpcBody("resources/templates/list", `{}`), ""},
+	{"send_message", "POST", "/mcp", toolCall("send_message", `{"message":"hi"}`), scopeMessagesWrite},
+	{"get_messages", "POST", "/mcp", toolCall("get_messages", `{}`), scopeMessagesRead},
+	{"clear_messages", "POST", "/mcp", toolCall("clear_messages", `{}`), scopeAdmin},
+	{"resources/list", "POST", "/mcp", rpcBody("resources/list", `{}`), scopeMessagesRead},
+	{"resources/read", "POST", "/mcp", rpcBody("resources/read", `{"uri":"cicy://messages"}`), scopeMessagesRead},
+	{"resources/subscribe", "POST", "/mcp", rpcBody("resources/subscribe", `{"uri":"cicy://messages"}`), scopeMessagesRead},
+	{"resources/unsubscribe", "POST", "/mcp", rpcBody("resources/unsubscribe", `{"uri":"cicy://messages"}`), scopeMessagesRead},
+	{"prompts/list", "POST", "/mcp", rpcBody("prompts/list", `{}`), scopeMessagesRead},
+	{"prompts/get", "POST", "/mcp", rpcBody("prompts/get", `{"name":"summarize_today"}`), scopeMessagesRead},
+}
+
+// 发送请求，返回 HTTP 状态码；MCP 的权限错误（-32003）按 403 返回
+func doScopeRequest(t *testing.T, server *httptest.Server, c scopeCase, token string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(c.method, server.URL+c.path, strings.NewReader(c.body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	setAuthHeader(req, token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var body strings.Builder
+	var rpc JSONRPCResponse
+	if c.path == "/mcp" && c.method == "POST" && resp.StatusCode == http.StatusOK {
+		json.NewDecoder(resp.Body).Decode(&rpc)
+		data, _ := json.Marshal(rpc)
+		body.Write(data)
+		if rpc.Error != nil && rpc.Error.Code == -32003 {
+			return http.StatusForbidden, body.String()
+		}
+		return resp.StatusCode, body.String()
+	}
+	buf := make([]byte, 4096)
+	n, _ := resp.Body.Read(buf)
+	body.Write(buf[:n])
+	return resp.StatusCode, body.String()
+}
+
+func TestScopeMatrix(t *testing.T) {
+	server, tokens := newTestServer(t)
+	scopes := []string{scopeMessagesRead, scopeMessagesWrite, scopeImagesWrite, scopeAdmin}
+
+	cases := append(append([]scopeCase{}, routeScopeCases...), rpcScopeCases...)
+	for _, c := range cases {
+		for _, scope := range scopes {
+			t.Run(c.name+"/"+scope, func(t *testing.T) {
+				status, body := doScopeRequest(t, server, c, tokens[scope])
+				allowed := c.scope == "" || scope == c.scope || scope == scopeAdmin
+				if allowed && (status == http.StatusForbidden || status == http.StatusUnauthorized) {
+					t.Errorf("status = %d, want allowed: %s", status, body)
+				}
+				if !allowed && status != http.StatusForbidden {
+					t.Errorf("status = %d, want 403: %s", status, body)
+				}
+			})
+		}
+	}
+}
+
+func TestScopeMatrixUnauthenticated(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	cases := append(append([]scopeCase{}, routeScopeCases...), rpcScopeCases...)
+	for _, token := range []string{"", "wrong-token"} {
+		for _, c := range cases {
+			if status, _ := doScopeRequest(t, server, c, token); status != http.StatusUnauthorized {
+				t.Errorf("%s with token %q: status = %d, want 401", c.name, token, status)
+			}
+		}
+	}
+
+	// 公开路径不需要 token
+	status, _ := doScopeRequest(t, server, scopeCase{method: "GET", path: "/health"}, "")
+	if status != http.StatusOK {
+		t.Errorf("GET /health: status = %d, want 200", status)
+	}
+}
+
+// 没有 messages:read 的 token 不能通过 prompts 读取消息记录
+func TestPromptsDoNotLeakMessages(t *testing.T) {
+	server, tokens := newTestServer(t)
+
+	send := scopeCase{method: "POST", path: "/api/message", body: `{"type":"text","text":"secret plan"}`}
+	if status, body := doScopeRequest(t, server, send, tokens[scopeAdmin]); status != http.StatusOK {
+		t.Fatalf("send: status = %d: %s", status, body)
+	}
+
+	get := scopeCase{method: "POST", path: "/mcp", body: rpcBody("prompts/get", `{"name":"summarize_today"}`)}
+	status, body := doScopeRequest(t, server, get, tokens[scopeMessagesWrite])
+	if status != http.StatusForbidden || strings.Contains(body, "secret plan") {
+		t.Errorf("messages:write prompts/get: status = %d, body = %s", status, body)
+	}
+	status, body = doScopeRequest(t, server, get, tokens[scopeMessagesRead])
+	if status != http.StatusOK || !strings.Contains(body, "secret plan") {
+		t.Errorf("messages:read prompts/get: status = %d, body = %s", status, body)
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket：GET /ws（需要 messages:read），每个事件一个 JSON 文本帧
+//
+// 服务器 → 客户端：
+//
+//	{"type": "message", "message": {...}, "url": "/api/images/3/raw"}  新消息（不含文件数据）
+//	{"type": "ack", "ref": "r1", "ids": [12]}                           send 已保存
+//	{"type": "chunk", "ref": "r1", "text": "..."}                       回复片段（reply: true 时）
+//	{"type": "reply", "ref": "r1", "text": "..."}                       完整回复
+//	{"type": "error", "ref": "r1", "error": "...", "retryAfter": 1}
+//
+// 客户端 → 服务器（content 与 POST /api/message 相同，权限和限流也相同）：
+//
+//	{"type": "send", "ref": "r1", "text": "hi", "reply": true}
+//	{"type": "send", "ref": "r2", "content": [{"type": "image", "data": "..."}]}
+//
+// ?after_id=N 连接后先补发 ID 大于 N 的所有消息（分页读取），断线重连时不会漏消息；
+// 通过同一连接发送的消息不会再推送回这个连接。
+//
+// 浏览器不能设置请求头，token 放在子协议中：new WebSocket(url, ["cicy", "cicy.token.<base64url(token)>"])，
+// 服务器选择 cicy 子协议。旧的 ?token= 仍然可用，但 URL 会出现在访问日志和代理日志中，不推荐使用。
+const (
+	wsPingInterval  = 30 * time.Second
+	wsReadTimeout   = 90 * time.Second
+	wsWriteTimeout  = 10 * time.Second
+	wsBufferSize    = 256  // 每个连接缓存的事件数，超出时断开连接，客户端用 after_id 重连补齐
+	wsReplayPage    = 1000 // after_id 补发时每次从存储读取的消息数
+	wsProtocol      = "cicy"
+	wsTokenProtocol = "cicy.token." // 后面是 base64url（不带填充）编码的 token
+)
+
+// 从 Sec-WebSocket-Protocol 中取 token
+func wsProtocolToken(r *http.Request) string {
+	for _, protocol := range websocket.Subprotocols(r) {
+		if !strings.HasPrefix(protocol, wsTokenProtocol) {
+			continue
+		}
+		if token, err := base64.RawURLEncoding.DecodeString(protocol[len(wsTokenProtocol):]); err == nil {
+			return string(token)
+		}
+	}
+	return ""
+}
+
+var wsUpgrader = websocket.Upgrader{
+	// 客户端用子协议传 token 时必须选择一个子协议，否则浏览器会断开连接
+	Subprotocols: []string{wsProtocol},
+	// 带 token 的请求不依赖 cookie 等浏览器自动附带的凭据，允许任意来源（浏览器看板）；
+	// 只用客户端证书认证时要求同源
+	CheckOrigin: func(r *http.Request) bool {
+		return requestToken(r) != "" || sameOrigin(r)
+	},
+}
+
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+type wsFrame struct {
+	id   int // 消息事件的 ID，其他事件为 0
+	data []byte
+}
+
+type wsClient struct {
+	send      chan wsFrame
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *wsClient) close() {
+	c.closeOnce.Do(func() { close(c.done) })
+}
+
+// 发送 ack / reply 等直接响应，连接关闭时放弃
+func (c *wsClient) reply(event map[string]interface{}) {
+	data, _ := json.Marshal(event)
+	select {
+	case c.send <- wsFrame{data: data}:
+	case <-c.done:
+	}
+}
+
+var wsHub = struct {
+	sync.Mutex
+	clients map[*wsClient]struct{}
+}{clients: map[*wsClient]struct{}{}}
+
+type wsOriginKey struct{}
+
+// 新消息推送给所有 WebSocket 连接（发送它的连接除外）
+func publishMessage(ctx context.Context, msg Message) {
+	origin, _ := ctx.Value(wsOriginKey{}).(*wsClient)
+	data, _ := json.Marshal(messageEvent(msg))
+
+	wsHub.Lock()
+	defer wsHub.Unlock()
+	for c := range wsHub.clients {
+		if c == origin {
+			continue
+		}
+		select {
+		case c.send <- wsFrame{id: msg.ID, data: data}:
+		default:
+			log.Printf("⚠️  WebSocket 缓冲已满，断开连接")
+			delete(wsHub.clients, c)
+			c.close()
+		}
+	}
+}
+
+// 服务器关闭时断开所有 WebSocket（被接管的连接不受 Shutdown 管理）
+func closeAllWebSockets() {
+	wsHub.Lock()
+	defer wsHub.Unlock()
+	for c := range wsHub.clients {
+		delete(wsHub.clients, c)
+		c.close()
+	}
+}
+
+func messageEvent(msg Message) map[string]interface{} {
+	msg.Data = "" // 旧版本记录中的 base64 图片通过 url 下载
+	event := map[string]interface{}{"type": "message", "message": msg}
+	switch msg.Type {
+	case "image":
+		event["url"] = fmt.Sprintf("/api/images/%d/raw", msg.ID)
+	case "attachment":
+		event["url"] = fmt.Sprintf("/api/attachments/%d/raw", msg.ID)
+	}
+	return event
+}
+
+// GET /ws
+func wsHandler(w http.ResponseWriter, r *http.Request) {
+	afterID := -1
+	if v := r.URL.Query().Get("after_id"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid after_id", http.StatusBadRequest)
+			return
+		}
+		afterID = n
+	}
+
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade 已经写了错误响应
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(maxUploadSize)
+
+	c := &wsClient{send: make(chan wsFrame, wsBufferSize), done: make(chan struct{})}
+	wsHub.Lock()
+	wsHub.clients[c] = struct{}{}
+	wsHub.Unlock()
+	defer func() {
+		wsHub.Lock()
+		delete(wsHub.clients, c)
+		wsHub.Unlock()
+		c.close()
+	}()
+	log.Printf("🔌 WebSocket 已连接: %s", limitKey(r))
+
+	// 先订阅再补发，补发过的消息在写循环中跳过
+	lastID := 0
+	for after := afterID; after >= 0; {
+		missed, err := store.Find(MessageQuery{AfterID: after, Limit: wsReplayPage})
+		if err != nil {
+			log.Printf("❌ 读取消息失败: %v", err)
+			return
+		}
+		for _, msg := range missed {
+			data, _ := json.Marshal(messageEvent(msg))
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+			lastID = msg.ID
+		}
+		if len(missed) < wsReplayPage {
+			break
+		}
+		after = lastID
+	}
+
+	go wsWriteLoop(conn, c, lastID)
+
+	ctx := context.WithValue(r.Context(), wsOriginKey{}, c)
+	conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+	})
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("🔌 WebSocket 断开: %v", err)
+			}
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+		wsHandleFrame(ctx, r, c, data)
+	}
+}
+
+// 唯一的写入方：事件、直接响应和心跳
+func wsWriteLoop(conn *websocket.Conn, c *wsClient, lastID int) {
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	defer conn.Close()
+
+	for {
+		select {
+		case <-c.done:
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server closing"),
+				time.Now().Add(time.Second))
+			return
+		case frame := <-c.send:
+			if frame.id != 0 && frame.id <= lastID {
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteMessage(websocket.TextMessage, frame.data); err != nil {
+				c.close()
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				c.close()
+				return
+			}
+		}
+	}
+}
+
+type wsRequest struct {
+	Type    string                   `json:"type"`
+	Ref     string                   `json:"ref,omitempty"`
+	Text    string                   `json:"text,omitempty"`
+	Content []map[string]interface{} `json:"content,omitempty"`
+	Reply   bool                     `json:"reply,omitempty"`
+}
+
+func wsHandleFrame(ctx context.Context, r *http.Request, c *wsClient, data []byte) {
+	var req wsRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		c.reply(map[string]interface{}{"type": "error", "error": "invalid JSON"})
+		return
+	}
+	if req.Type != "send" {
+		c.reply(map[string]interface{}{"type": "error", "ref": req.Ref, "error": fmt.Sprintf("unknown type: %q", req.Type)})
+		return
+	}
+	if ok, wait := takeToken(limitKey(r), time.Now()); !ok {
+		seconds := retryAfterSeconds(wait)
+		c.reply(map[string]interface{}{
+			"type":       "error",
+			"ref":        req.Ref,
+			"error":      fmt.Sprintf("rate limit exceeded, retry after %ds", seconds),
+			"retryAfter": seconds,
+		})
+		return
+	}
+
+	content := req.Content
+	if req.Text != "" {
+		content = append([]map[string]interface{}{{"type": "text", "text": req.Text}}, content...)
+	}
+	if len(content) == 0 {
+		c.reply(map[string]interface{}{"type": "error", "ref": req.Ref, "error": "text or content is required"})
+		return
+	}
+
+	ids := []int{}
+	for _, item := range content {
+		saved, err := ingestContentItem(ctx, item)
+		if err != nil {
+			c.reply(map[string]interface{}{"type": "error", "ref": req.Ref, "error": asAPIError(err).msg, "ids": ids})
+			return
+		}
+		ids = append(ids, saved.ID)
+	}
+	c.reply(map[string]interface{}{"type": "ack", "ref": req.Ref, "ids": ids})
+
+	// 回复可能很慢（openai），不阻塞读取后续消息
+	if req.Reply && req.Text != "" {
+		go func() {
+			reply, err := respondStream(ctx, responder, req.Text, func(chunk string) {
+				c.reply(map[string]interface{}{"type": "chunk", "ref": req.Ref, "text": chunk})
+			})
+			if err != nil {
+				log.Printf("❌ 生成回复失败: %v", err)
+				c.reply(map[string]interface{}{"type": "error", "ref": req.Ref, "error": err.Error()})
+				return
+			}
+			c.reply(map[string]interface{}{"type": "reply", "ref": req.Ref, "text": reply})
+		}()
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func dialTestWS(t *testing.T, url string, protocols []string, header http.Header) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+	dialer := websocket.Dialer{Subprotocols: protocols, HandshakeTimeout: 5 * time.Second}
+	conn, resp, err := dialer.Dial(strings.Replace(url, "http://", "ws://", 1), header)
+	if conn != nil {
+		t.Cleanup(func() { conn.Close() })
+	}
+	return conn, resp, err
+}
+
+// 浏览器通过子协议传 token，服务器选择 cicy 子协议
+func TestWSProtocolToken(t *testing.T) {
+	server, tokens := newTestServer(t)
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(tokens[scopeMessagesRead]))
+
+	conn, _, err := dialTestWS(t, server.URL+"/ws", []string{wsProtocol, wsTokenProtocol + encoded}, nil)
+	if err != nil {
+		t.Fatalf("dial with protocol token: %v", err)
+	}
+	if got := conn.Subprotocol(); got != wsProtocol {
+		t.Errorf("subprotocol = %q, want %q", got, wsProtocol)
+	}
+
+	wrong := base64.RawURLEncoding.EncodeToString([]byte("wrong-token"))
+	if _, resp, err := dialTestWS(t, server.URL+"/ws", []string{wsProtocol, wsTokenProtocol + wrong}, nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("wrong protocol token: err = %v", err)
+	}
+}
+
+// after_id 补发超过一页的消息
+func TestWSReplayAll(t *testing.T) {
+	server, tokens := newTestServer(t)
+	total := wsReplayPage*2 + 5
+	for i := 0; i < total; i++ {
+		store.Append(Message{Type: "text", Text: "hi"})
+	}
+
+	header := http.Header{"Authorization": {"Bearer " + tokens[scopeMessagesRead]}}
+	conn, _, err := dialTestWS(t, server.URL+"/ws?after_id=3", nil, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for want := 4; want <= total; want++ {
+		var event struct {
+			Type    string  `json:"type"`
+			Message Message `json:"message"`
+		}
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read message %d: %v", want, err)
+		}
+		json.Unmarshal(data, &event)
+		if event.Type != "message" || event.Message.ID != want {
+			t.Fatalf("event = %s, want message %d", data, want)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 分层配置：默认值 → 配置文件 → CICY_* 环境变量 → 命令行参数
+//
+// 与 server-go 共用 ~/.config/cicy/config.yaml（--config 或 CICY_CONFIG 指定其他路径），
+// tui-go 只使用其中的 url / port / token / token-file 和客户端 TLS 设置，其他键忽略；
+// tls-cert / tls-self-signed / data-dir 是服务器的设置，只用来推导默认 url 和信任本机的自签名证书。
+// 加载顺序和 url 的推导与 server-go/config.go 保持一致。
+// 环境变量为 CICY_ 加大写键名，"-" 换成 "_"，例如 CICY_TOKEN_FILE
+type configEntry struct {
+	key    string
+	value  string
+	source string // default / 配置文件路径 / env 变量名 / flag
+	secret bool   // config print 时隐藏
+}
+
+type config struct {
+	path    string
+	exists  bool
+	entries []*configEntry
+}
+
+// 当前生效的配置
+var appConfig = defaultConfig()
+
+func defaultConfig() *config {
+	homeDir, _ := os.UserHomeDir()
+	return &config{entries: []*configEntry{
+		{key: "url", value: "http://localhost:13001", source: "default"},
+		{key: "port", value: "13001", source: "default"},
+		{key: "token", value: "", source: "default", secret: true},
+		{key: "token-file", value: filepath.Join(homeDir, "data", "cicy-server.txt"), source: "default"},
+		{key: "tls-ca", value: "", source: "default"},
+		{key: "tls-client-cert", value: "", source: "default"},
+		{key: "tls-client-key", value: "", source: "default"},
+		{key: "tls-cert", value: "", source: "default"},
+		{key: "tls-self-signed", value: "false", source: "default"},
+		{key: "data-dir", value: filepath.Join(homeDir, "data", "cicy"), source: "default"},
+	}}
+}
+
+func (c *config) entry(key string) *configEntry {
+	for _, e := range c.entries {
+		if e.key == key {
+			return e
+		}
+	}
+	return nil
+}
+
+func (c *config) set(key, value, source string) {
+	if e := c.entry(key); e != nil {
+		e.value = expandHome(value)
+		e.source = source
+	}
+}
+
+func (c *config) get(key string) string {
+	if e := c.entry(key); e != nil {
+		return e.value
+	}
+	return ""
+}
+
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(homeDir, path[2:])
+}
+
+// 配置文件路径：--config 参数 > CICY_CONFIG > 默认路径；显式指定的文件必须存在
+func configPathFromArgs(args []string) (string, bool) {
+	for i, arg := range args {
+		for _, name := range []string{"-config", "--config"} {
+			if arg == name && i+1 < len(args) {
+				return expandHome(args[i+1]), true
+			}
+			if strings.HasPrefix(arg, name+"=") {
+				return expandHome(strings.TrimPrefix(arg, name+"=")), true
+			}
+		}
+	}
+	if path := os.Getenv("CICY_CONFIG"); path != "" {
+		return expandHome(path), true
+	}
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".config", "cicy", "config.yaml"), false
+}
+
+// 依次应用配置文件和环境变量
+func loadConfig(path string, explicit bool) (*config, error) {
+	c := defaultConfig()
+	c.path = path
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		c.exists = true
+		var values map[string]interface{}
+		if err := yaml.Unmarshal(data, &values); err != nil {
+			return nil, fmt.Errorf("解析配置文件 %s 失败: %v", path, err)
+		}
+		for key, value := range values {
+			c.set(key, fmt.Sprint(value), path)
+		}
+	case os.IsNotExist(err) && !explicit:
+	default:
+		return nil, fmt.Errorf("无法读取配置文件: %v", err)
+	}
+
+	for _, e := range c.entries {
+		name := "CICY_" + strings.ToUpper(strings.ReplaceAll(e.key, "-", "_"))
+		if value := os.Getenv(name); value != "" {
+			c.set(e.key, value, "env "+name)
+		}
+	}
+
+	c.deriveURL()
+	return c, nil
+}
+
+// 服务器是否开启了 TLS（与 server-go 的 tlsEnabled 相同）
+func (c *config) tlsEnabled() bool {
+	selfSigned, _ := strconv.ParseBool(c.get("tls-self-signed"))
+	return c.get("tls-cert") != "" || selfSigned
+}
+
+// 未指定 url 时连接配置的端口（与服务器共用 port，开启 TLS 时使用 https）
+//
+// 加载配置时调用一次作为参数的默认值，应用命令行参数后再调用一次，-p 等参数也会生效。
+// 与 server-go/config.go 中的同名函数保持一致
+func (c *config) deriveURL() {
+	e := c.entry("url")
+	if e.source != "default" {
+		return
+	}
+	if port, err := strconv.Atoi(c.get("port")); err == nil {
+		scheme := "http"
+		if c.tlsEnabled() {
+			scheme = "https"
+		}
+		e.value = fmt.Sprintf("%s://localhost:%d", scheme, port)
+	}
+}
+
+// 命令行参数的简写（与 server-go 相同）
+var flagAliases = map[string]string{"p": "port"}
+
+// 记录命令行中显式设置的参数
+func (c *config) applyFlags(fs *flag.FlagSet) {
+	fs.Visit(func(f *flag.Flag) {
+		key := f.Name
+		if alias, ok := flagAliases[key]; ok {
+			key = alias
+		}
+		c.set(key, f.Value.String(), "flag --"+key)
+	})
+}
+
+// config print：显示生效的配置和来源
+func (c *config) print(w io.Writer) {
+	status := ""
+	if !c.exists {
+		status = " (不存在)"
+	}
+	fmt.Fprintf(w, "# 配置文件: %s%s\n", c.path, status)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, e := range c.entries {
+		value := e.value
+		if e.secret && value != "" {
+			value = "********"
+		}
+		if value == "" {
+			value = `""`
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", e.key, value, e.source)
+	}
+	tw.Flush()
+}
@@ -3,9 +3,16 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,12 +22,14 @@ import (
 	"github.com/charmbracelet/lipgloss"
 )
 
-const API_URL = "http://localhost:13001"
+// 服务器地址，来自配置（url）
+var API_URL = "http://localhost:13001"
 
 type message struct {
 	question string
 	answer   string
 	elapsed  float64
+	live     bool // 其他客户端发送、通过 /ws 收到的消息
 }
 
 type model struct {
@@ -30,6 +39,7 @@ type model struct {
 	loading  bool
 	showHelp bool
 	err      string
+	live     bool // /ws 已连接
 }
 
 type responseMsg struct {
@@ -37,6 +47,13 @@ type responseMsg struct {
 	elapsed float64
 }
 
+// 图片 / 附件下载完成
+type fileFetchedMsg struct {
+	command string
+	path    string
+	err     error
+}
+
 var (
 	titleColor  = lipgloss.Color("#7aa2f7")
 	userColor   = lipgloss.Color("#f7768e")
@@ -47,7 +64,51 @@ var (
 )
 
 func main() {
+	configPath, explicit := configPathFromArgs(os.Args[1:])
+	cfg, err := loadConfig(configPath, explicit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		os.Exit(2)
+	}
+	appConfig = cfg
+
+	// tui-go [config print] [--url URL | -p PORT] [--token TOKEN] [--token-file FILE] [--tls-ca FILE] [--config FILE]
+	args := os.Args[1:]
+	printConfig := len(args) > 0 && args[0] == "config"
+	if printConfig {
+		if len(args) < 2 || args[1] != "print" {
+			fmt.Fprintf(os.Stderr, "用法: tui-go config print [选项]\n")
+			os.Exit(2)
+		}
+		args = args[2:]
+	}
+
+	flag.String("config", configPath, "配置文件 (YAML)")
+	flag.String("url", cfg.get("url"), "服务器地址 (CICY_URL，默认 localhost 上的 --port)")
+	port, _ := strconv.Atoi(cfg.get("port"))
+	flag.IntVar(&port, "port", port, "未指定 --url 时连接的本机端口")
+	flag.IntVar(&port, "p", port, "未指定 --url 时连接的本机端口")
+	flag.String("token", "", "API token (CICY_TOKEN，默认读取 token 文件)")
+	flag.String("token-file", cfg.get("token-file"), "API token 文件")
+	flag.String("tls-ca", cfg.get("tls-ca"), "只信任该 CA 签发的服务器证书 (PEM)")
+	flag.String("tls-client-cert", cfg.get("tls-client-cert"), "双向 TLS 的客户端证书 (PEM)")
+	flag.String("tls-client-key", cfg.get("tls-client-key"), "客户端证书的私钥 (PEM)")
+	flag.CommandLine.Parse(args)
+	cfg.applyFlags(flag.CommandLine)
+	cfg.deriveURL()
+
+	if printConfig {
+		cfg.print(os.Stdout)
+		return
+	}
+	API_URL = strings.TrimRight(cfg.get("url"), "/")
+	if err := setupTLS(); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		os.Exit(2)
+	}
+
 	p := tea.NewProgram(initialModel())
+	go runLive(p)
 	if _, err := p.Run(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
@@ -132,6 +193,37 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		})
 		return m, nil
 
+	case liveMsg:
+		from := "📨"
+		if msg.msg.Sender != "" {
+			from += " " + msg.msg.Sender
+		}
+		m.messages = append(m.messages, message{
+			question: from,
+			answer:   msg.msg.summary(),
+			live:     true,
+		})
+		return m, nil
+
+	case liveStatusMsg:
+		m.live = msg.connected
+		if msg.err != "" {
+			m.err = msg.err
+		}
+		return m, nil
+
+	case fileFetchedMsg:
+		m.loading = false
+		if msg.err != nil {
+			m.err = msg.err.Error()
+			return m, nil
+		}
+		m.messages = append(m.messages, message{
+			question: msg.command,
+			answer:   "已保存: " + msg.path,
+		})
+		return m, nil
+
 	case spinner.TickMsg:
 		if m.loading {
 			var cmd tea.Cmd
@@ -170,6 +262,36 @@ func (m model) handleCommand(cmd string) (tea.Model, tea.Cmd) {
 		m.showHelp = true
 		m.input.SetValue("")
 
+	case "/image", "/i":
+		m.input.SetValue("")
+		if len(parts) < 2 {
+			m.err = "Usage: /image <id>"
+			return m, nil
+		}
+		id, err := strconv.Atoi(parts[1])
+		if err != nil || id <= 0 {
+			m.err = "Usage: /image <id>"
+			return m, nil
+		}
+		m.loading = true
+		m.err = ""
+		return m, tea.Batch(m.spinner.Tick, fetchFile("images", id))
+
+	case "/file", "/f":
+		m.input.SetValue("")
+		if len(parts) < 2 {
+			m.err = "Usage: /file <id>"
+			return m, nil
+		}
+		id, err := strconv.Atoi(parts[1])
+		if err != nil || id <= 0 {
+			m.err = "Usage: /file <id>"
+			return m, nil
+		}
+		m.loading = true
+		m.err = ""
+		return m, tea.Batch(m.spinner.Tick, fetchFile("attachments", id))
+
 	default:
 		m.err = fmt.Sprintf("Unknown command: %s", command)
 		m.input.SetValue("")
@@ -192,6 +314,9 @@ func (m model) View() string {
 		Foreground(titleColor).
 		Render("◇ CICY")
 	b.WriteString(title)
+	if m.live {
+		b.WriteString(lipgloss.NewStyle().Foreground(aiColor).Render(" ● live"))
+	}
 	b.WriteString("\n\n")
 
 	// 显示历史对话（最近 5 条）
@@ -217,6 +342,11 @@ func (m model) View() string {
 		b.WriteString(aiMsg)
 		b.WriteString("\n")
 
+		if msg.live {
+			b.WriteString("\n")
+			continue
+		}
+
 		// 完成耗时
 		timeMsg := lipgloss.NewStyle().
 			Foreground(timeColor).
@@ -279,6 +409,8 @@ func (m model) renderHelp() string {
 		{"/quit, /q", "退出程序"},
 		{"/clear, /c", "清空消息历史"},
 		{"/list, /l", "显示所有消息"},
+		{"/image, /i <id>", "下载并打开服务器上的图片"},
+		{"/file, /f <id>", "下载并打开服务器上的附件"},
 		{"Ctrl+C", "退出程序"},
 		{"Esc", "退出帮助/退出程序"},
 	}
@@ -307,14 +439,26 @@ func sendRequest(message string) tea.Cmd {
 	return func() tea.Msg {
 		startTime := time.Now()
 
+		// 优先经由 /ws 发送，这样自己的消息不会作为新消息推送回来
+		reply, err := live.send(message)
+		if err != errNotConnected {
+			elapsed := time.Since(startTime).Seconds()
+			if err != nil {
+				reply = fmt.Sprintf("Error: %v", err)
+			}
+			return responseMsg{text: reply, elapsed: elapsed}
+		}
+
 		data := map[string]string{"message": message}
 		jsonData, _ := json.Marshal(data)
 
-		resp, err := http.Post(
-			API_URL+"/message",
-			"application/json",
-			bytes.NewBuffer(jsonData),
-		)
+		req, _ := http.NewRequest(http.MethodPost, API_URL+"/message", bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+		if token := loadToken(); token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := httpClient.Do(req)
 		if err != nil {
 			elapsed := time.Since(startTime).Seconds()
 			return responseMsg{
@@ -324,11 +468,17 @@ func sendRequest(message string) tea.Cmd {
 		}
 		defer resp.Body.Close()
 
+		elapsed := time.Since(startTime).Seconds()
+		if resp.StatusCode == http.StatusUnauthorized {
+			return responseMsg{
+				text:    "Error: unauthorized (check CICY_TOKEN or token-file)",
+				elapsed: elapsed,
+			}
+		}
+
 		var result map[string]interface{}
 		json.NewDecoder(resp.Body).Decode(&result)
 
-		elapsed := time.Since(startTime).Seconds()
-
 		if msg, ok := result["message"].(string); ok {
 			return responseMsg{
 				text:    msg,
@@ -342,3 +492,93 @@ func sendRequest(message string) tea.Cmd {
 		}
 	}
 }
+
+// 读取 API token：配置中的 token（--token / CICY_TOKEN）或 token 文件
+func loadToken() string {
+	if token := appConfig.get("token"); token != "" {
+		return token
+	}
+	data, err := os.ReadFile(appConfig.get("token-file"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// 从 GET /api/{images|attachments}/{id}/raw 下载到临时目录并打开
+func fetchFile(kind string, id int) tea.Cmd {
+	command := fmt.Sprintf("/image %d", id)
+	if kind == "attachments" {
+		command = fmt.Sprintf("/file %d", id)
+	}
+
+	return func() tea.Msg {
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/%s/%d/raw", API_URL, kind, id), nil)
+		if err != nil {
+			return fileFetchedMsg{command: command, err: err}
+		}
+		if token := loadToken(); token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return fileFetchedMsg{command: command, err: err}
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return fileFetchedMsg{command: command, err: fmt.Errorf("%s: HTTP %d", command, resp.StatusCode)}
+		}
+
+		// 附件使用服务器给出的原文件名，图片按 MIME 类型取扩展名
+		name := ""
+		if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+			name = filepath.Base(params["filename"])
+		}
+		if name == "" || name == "." || name == ".." || name == string(filepath.Separator) {
+			ext := ""
+			if exts, _ := mime.ExtensionsByType(resp.Header.Get("Content-Type")); len(exts) > 0 {
+				ext = exts[0]
+			}
+			name = fmt.Sprintf("image%s", ext)
+		}
+		file, err := createTempFile(name)
+		if err != nil {
+			return fileFetchedMsg{command: command, err: err}
+		}
+		path := file.Name()
+		_, err = io.Copy(file, resp.Body)
+		file.Close()
+		if err != nil {
+			return fileFetchedMsg{command: command, err: err}
+		}
+
+		openFile(path)
+		return fileFetchedMsg{command: command, path: path}
+	}
+}
+
+// 在新建的私有临时目录（0700，名字随机）中创建文件，保留原文件名；
+// 不使用可预测的路径，也不会跟随别人预先放好的符号链接
+func createTempFile(name string) (*os.File, error) {
+	dir, err := os.MkdirTemp("", "cicy-*")
+	if err != nil {
+		return nil, err
+	}
+	return os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+}
+
+// 用系统默认程序打开文件
+func openFile(path string) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", path)
+	case "windows":
+		cmd = exec.Command("cmd", "/c", "start", "", path)
+	default:
+		cmd = exec.Command("xdg-open", path)
+	}
+	cmd.Start()
+}
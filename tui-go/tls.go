@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// 访问服务器的 HTTP client
+var httpClient = http.DefaultClient
+
+// 服务器使用自签名证书或私有 CA 时用 tls-ca 固定信任的 CA，
+// 服务器开启双向 TLS 时用 tls-client-cert / tls-client-key 出示客户端证书
+func setupTLS() error {
+	caFile := appConfig.get("tls-ca")
+	// 与 server-go 相同：本机服务器使用 --tls-self-signed 时默认信任数据目录中的自签名证书
+	if caFile == "" && appConfig.get("tls-cert") == "" && appConfig.tlsEnabled() {
+		if certFile := filepath.Join(appConfig.get("data-dir"), "tls", "cert.pem"); fileExists(certFile) {
+			caFile = certFile
+		}
+	}
+	certFile, keyFile := appConfig.get("tls-client-cert"), appConfig.get("tls-client-key")
+	if caFile == "" && certFile == "" {
+		return nil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return fmt.Errorf("无法读取 CA 证书: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("%s 中没有 PEM 格式的证书", caFile)
+		}
+		config.RootCAs = pool
+	}
+	if certFile != "" {
+		if keyFile == "" {
+			return errors.New("--tls-client-cert 需要同时指定 --tls-client-key")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("无法加载客户端证书: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	httpClient = &http.Client{Transport: transport}
+	return nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
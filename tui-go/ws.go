@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/bubbletea"
+	"github.com/gorilla/websocket"
+)
+
+// 通过 GET /ws 接收服务器上的新消息（其他客户端发送的），并在连接可用时经由它发送消息
+//
+// 断线后每 2 秒重连，用 after_id 补齐断线期间的消息；token 无效时停止
+const wsReconnectDelay = 2 * time.Second
+
+var errNotConnected = errors.New("websocket not connected")
+
+// 服务器推送的事件
+type wsEvent struct {
+	Type    string    `json:"type"`
+	Ref     string    `json:"ref"`
+	Text    string    `json:"text"`
+	Error   string    `json:"error"`
+	IDs     []int     `json:"ids"`
+	Message wsMessage `json:"message"`
+}
+
+type wsMessage struct {
+	ID     int    `json:"id"`
+	Type   string `json:"type"`
+	Text   string `json:"text"`
+	Name   string `json:"name"`
+	Size   int    `json:"size"`
+	Sender string `json:"sender"`
+}
+
+// 收到其他客户端的新消息
+type liveMsg struct {
+	msg wsMessage
+}
+
+// 连接状态变化
+type liveStatusMsg struct {
+	connected bool
+	err       string
+}
+
+type liveConn struct {
+	mu      sync.Mutex
+	conn    *websocket.Conn
+	pending map[string]chan wsEvent // 等待回复的 send，按 ref
+	seq     int
+	lastID  int // 见过的最大消息 ID，重连时作为 after_id
+}
+
+var live = &liveConn{pending: map[string]chan wsEvent{}}
+
+func wsURL(lastID int) string {
+	u := API_URL + "/ws"
+	if strings.HasPrefix(u, "https://") {
+		u = "wss://" + strings.TrimPrefix(u, "https://")
+	} else {
+		u = "ws://" + strings.TrimPrefix(u, "http://")
+	}
+	if lastID > 0 {
+		u += "?after_id=" + strconv.Itoa(lastID)
+	}
+	return u
+}
+
+// 后台保持连接，把新消息发送到 TUI
+func runLive(p *tea.Program) {
+	dialer := *websocket.DefaultDialer
+	if t, ok := httpClient.Transport.(*http.Transport); ok {
+		dialer.TLSClientConfig = t.TLSClientConfig
+	}
+
+	for {
+		header := http.Header{}
+		if token := loadToken(); token != "" {
+			header.Set("Authorization", "Bearer "+token)
+		}
+		live.mu.Lock()
+		url := wsURL(live.lastID)
+		live.mu.Unlock()
+
+		conn, resp, err := dialer.Dial(url, header)
+		if err != nil {
+			if resp != nil && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) {
+				p.Send(liveStatusMsg{err: fmt.Sprintf("live updates disabled: HTTP %d", resp.StatusCode)})
+				return
+			}
+			time.Sleep(wsReconnectDelay)
+			continue
+		}
+
+		live.mu.Lock()
+		live.conn = conn
+		live.mu.Unlock()
+		p.Send(liveStatusMsg{connected: true})
+
+		live.read(conn, p)
+
+		live.mu.Lock()
+		live.conn = nil
+		for ref, ch := range live.pending {
+			close(ch)
+			delete(live.pending, ref)
+		}
+		live.mu.Unlock()
+		conn.Close()
+		p.Send(liveStatusMsg{})
+		time.Sleep(wsReconnectDelay)
+	}
+}
+
+func (l *liveConn) read(conn *websocket.Conn, p *tea.Program) {
+	for {
+		var event wsEvent
+		if err := conn.ReadJSON(&event); err != nil {
+			return
+		}
+
+		l.mu.Lock()
+		for _, id := range append(event.IDs, event.Message.ID) {
+			if id > l.lastID {
+				l.lastID = id
+			}
+		}
+		ch := l.pending[event.Ref]
+		l.mu.Unlock()
+
+		switch {
+		case event.Type == "message":
+			p.Send(liveMsg{msg: event.Message})
+		case ch != nil && event.Type != "chunk":
+			// 每个 send 只有 ack 和 reply / error，缓冲不会满
+			ch <- event
+		}
+	}
+}
+
+// 经由 WebSocket 发送消息并等待回复；未连接时返回 errNotConnected
+func (l *liveConn) send(text string) (string, error) {
+	l.mu.Lock()
+	if l.conn == nil {
+		l.mu.Unlock()
+		return "", errNotConnected
+	}
+	l.seq++
+	ref := "r" + strconv.Itoa(l.seq)
+	ch := make(chan wsEvent, 64)
+	l.pending[ref] = ch
+	err := l.conn.WriteJSON(map[string]interface{}{"type": "send", "ref": ref, "text": text, "reply": true})
+	l.mu.Unlock()
+
+	defer func() {
+		l.mu.Lock()
+		delete(l.pending, ref)
+		l.mu.Unlock()
+	}()
+	if err != nil {
+		return "", errNotConnected
+	}
+
+	timeout := time.After(2 * time.Minute)
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return "", errors.New("connection lost")
+			}
+			switch event.Type {
+			case "reply":
+				return event.Text, nil
+			case "error":
+				return "", errors.New(event.Error)
+			}
+		case <-timeout:
+			return "", errors.New("timeout waiting for reply")
+		}
+	}
+}
+
+// 消息列表中显示的内容
+func (m wsMessage) summary() string {
+	switch m.Type {
+	case "image":
+		return fmt.Sprintf("🖼️  %s (%d bytes) — /image %d", m.Name, m.Size, m.ID)
+	case "attachment":
+		return fmt.Sprintf("📎 %s (%d bytes) — /file %d", m.Name, m.Size, m.ID)
+	}
+	return m.Text
+}